@@ -0,0 +1,116 @@
+package gitprompt
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// BranchRewrite rewrites the branch names printed by %h and %H, e.g. to
+// shorten long prefixes such as feature/ to f/.
+type BranchRewrite struct {
+	Pattern *regexp.Regexp
+	// Replace replaces the matches of Pattern, $1 refers to the first
+	// submatch.
+	Replace string
+}
+
+// ParseBranchRewrite parses a rewrite rule, regexp=replacement, e.g.
+// "^(feature|bugfix)/([A-Z]+-[0-9]+).*=$1/$2". The rule is split at the first
+// = that isn't escaped, write \= for an = in the regexp.
+func ParseBranchRewrite(rule string) (BranchRewrite, error) {
+	i := ruleSeparator(rule)
+	if i <= 0 {
+		return BranchRewrite{}, fmt.Errorf("expected regexp=replacement, got %q", rule)
+	}
+	pattern, err := regexp.Compile(rule[:i])
+	if err != nil {
+		return BranchRewrite{}, err
+	}
+	return BranchRewrite{Pattern: pattern, Replace: rule[i+1:]}, nil
+}
+
+// ruleSeparator returns the index of the first = in rule that isn't escaped
+// with a backslash, or -1.
+func ruleSeparator(rule string) int {
+	escaped := false
+	for i, r := range rule {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '=':
+			return i
+		}
+	}
+	return -1
+}
+
+// ParseBranchPrefix parses a prefix rule, prefix=replacement, e.g.
+// "feature/=f/". An empty replacement strips the prefix.
+func ParseBranchPrefix(rule string) (BranchRewrite, error) {
+	parts := strings.SplitN(rule, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return BranchRewrite{}, fmt.Errorf("expected prefix=replacement, got %q", rule)
+	}
+	return BranchRewrite{
+		Pattern: regexp.MustCompile("^" + regexp.QuoteMeta(parts[0])),
+		Replace: strings.Replace(parts[1], "$", "$$", -1),
+	}, nil
+}
+
+// rewriteBranch applies the rules to the branch in order.
+func rewriteBranch(branch string, rules []BranchRewrite) string {
+	for _, rule := range rules {
+		branch = rule.Pattern.ReplaceAllString(branch, rule.Replace)
+	}
+	return branch
+}
+
+// truncate shortens s to at most width cells. The end, or the middle if
+// middle is set, is replaced by "…".
+func truncate(s string, width int, middle bool) string {
+	if cellWidth(s) <= width {
+		return s
+	}
+	// Leave a cell for the ellipsis.
+	width--
+	if !middle {
+		return cutEnd(s, width) + "…"
+	}
+	tail := width / 2
+	return cutEnd(s, width-tail) + "…" + cutStart(s, tail)
+}
+
+// cutEnd returns the longest prefix of s that is at most width cells.
+func cutEnd(s string, width int) string {
+	for i, r := range s {
+		if width -= runeWidth(r); width < 0 {
+			return s[:i]
+		}
+	}
+	return s
+}
+
+// cutStart returns the longest suffix of s that is at most width cells,
+// without leading combining marks.
+func cutStart(s string, width int) string {
+	i := len(s)
+	for i > 0 {
+		r, size := utf8.DecodeLastRuneInString(s[:i])
+		if width -= runeWidth(r); width < 0 {
+			break
+		}
+		i -= size
+	}
+	for i < len(s) {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if runeWidth(r) > 0 {
+			break
+		}
+		i += size
+	}
+	return s[i:]
+}
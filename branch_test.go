@@ -0,0 +1,86 @@
+package gitprompt
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseBranchRewrite(t *testing.T) {
+	tests := map[string]string{
+		"^(feature|bugfix)/([A-Z]+-[0-9]+).*=$1/$2": "feature/JIRA-1",
+		"^feature/=":       "JIRA-1-fix-the-thing",
+		"-[a-z-]+$=…":      "feature/JIRA-1…",
+		"thing=a=b":        "feature/JIRA-1-fix-the-a=b",
+		"^release/=rel/":   "feature/JIRA-1-fix-the-thing",
+		"(?i)jira-=J":      "feature/J1-fix-the-thing",
+		"^[^/]+/(.*)=${1}": "JIRA-1-fix-the-thing",
+		`fix\=?-=~`:        "feature/JIRA-1-~the-thing",
+		`1\\=x`:            "feature/JIRA-1-fix-the-thing",
+	}
+	for rule, expected := range tests {
+		rewrite, err := ParseBranchRewrite(rule)
+		if err != nil {
+			t.Errorf("%q: %v", rule, err)
+			continue
+		}
+		actual := rewriteBranch("feature/JIRA-1-fix-the-thing", []BranchRewrite{rewrite})
+		assertString(t, rule, expected, actual)
+	}
+
+	for _, invalid := range []string{"", "feature", "=f/", "(=x", `a\=b`} {
+		if _, err := ParseBranchRewrite(invalid); err == nil {
+			t.Errorf("%q: expected error", invalid)
+		}
+	}
+}
+
+func TestParseBranchPrefix(t *testing.T) {
+	tests := map[string]string{
+		"feature/=f/":  "f/x.y-feature/z",
+		"feature/=":    "x.y-feature/z",
+		"feature/=$1":  "$1x.y-feature/z",
+		"x.y=a":        "feature/x.y-feature/z",
+		"feature/x.=_": "_y-feature/z",
+	}
+	for rule, expected := range tests {
+		prefix, err := ParseBranchPrefix(rule)
+		if err != nil {
+			t.Errorf("%q: %v", rule, err)
+			continue
+		}
+		actual := rewriteBranch("feature/x.y-feature/z", []BranchRewrite{prefix})
+		assertString(t, rule, expected, actual)
+	}
+
+	for _, invalid := range []string{"", "feature/", "=f/"} {
+		if _, err := ParseBranchPrefix(invalid); err == nil {
+			t.Errorf("%q: expected error", invalid)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		s        string
+		width    int
+		middle   bool
+		expected string
+	}{
+		{"feature/long", 20, false, "feature/long"},
+		{"feature/long", 12, true, "feature/long"},
+		{"feature/long", 8, false, "feature…"},
+		{"feature/long", 8, true, "feat…ong"},
+		{"feature/long", 7, true, "fea…ong"},
+		{"feature/long", 1, false, "…"},
+		{"feature/long", 1, true, "…"},
+		{"功能/分支名", 6, false, "功能/…"},
+		{"功能/分支名", 6, true, "功…名"},
+		{"功能/分支名", 5, false, "功能…"},
+		{"e\u0301te\u0301", 2, false, "e\u0301…"},
+		{"e\u0301te\u0301s", 3, true, "e\u0301…s"},
+	}
+	for _, test := range tests {
+		actual := truncate(test.s, test.width, test.middle)
+		assertString(t, fmt.Sprintf("%s %d %v", test.s, test.width, test.middle), test.expected, actual)
+	}
+}
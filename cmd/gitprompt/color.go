@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/akupila/gitprompt"
+)
+
+// colorFlag selects the colors to print: auto, always, never, 16, 256 or
+// truecolor.
+type colorFlag struct {
+	value string
+}
+
+func (f *colorFlag) Set(v string) error {
+	switch v {
+	case "auto", "always", "never", "16", "256", "truecolor":
+		f.value = v
+		return nil
+	}
+	return fmt.Errorf("unknown color mode %q", v)
+}
+
+func (f *colorFlag) String() string {
+	if f.value == "" {
+		return "auto"
+	}
+	return f.value
+}
+
+// support returns the colors to print and the output to use. In auto mode
+// NO_COLOR disables colors, and nothing but text is printed if TERM is unset
+// or dumb. Prompts capture stdout and often discard stderr, so neither says
+// whether the prompt ends up in a terminal.
+func (f *colorFlag) support(output gitprompt.Output) (gitprompt.ColorSupport, gitprompt.Output) {
+	switch f.String() {
+	case "never":
+		return gitprompt.ColorNone, output
+	case "16":
+		return gitprompt.Color16, output
+	case "256":
+		return gitprompt.Color256, output
+	case "truecolor":
+		return gitprompt.ColorTrue, output
+	case "always":
+		return detectColors(), output
+	}
+	if os.Getenv("NO_COLOR") != "" {
+		return gitprompt.ColorNone, output
+	}
+	if output == gitprompt.OutputTmux {
+		// tmux maps colors to what the terminal supports.
+		return gitprompt.ColorTrue, output
+	}
+	if output == gitprompt.OutputANSI {
+		if term := os.Getenv("TERM"); term == "" || term == "dumb" {
+			return gitprompt.ColorNone, gitprompt.OutputPlain
+		}
+	}
+	return detectColors(), output
+}
+
+// detectColors returns the colors supported by the terminal according to
+// COLORTERM and TERM.
+func detectColors() gitprompt.ColorSupport {
+	switch os.Getenv("COLORTERM") {
+	case "truecolor", "24bit":
+		return gitprompt.ColorTrue
+	}
+	if strings.Contains(os.Getenv("TERM"), "256color") {
+		return gitprompt.Color256
+	}
+	return gitprompt.Color16
+}
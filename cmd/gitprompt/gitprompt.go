@@ -4,6 +4,8 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"os/exec"
+	"strings"
 
 	"github.com/akupila/gitprompt"
 )
@@ -15,11 +17,19 @@ var (
 	goversion = "unknown"
 )
 
-const defaultFormat = "#B([@b#R%h][#y ›%s][#m ↓%b][#m ↑%a][#r x%c][#g +%m][#y %u]#B) "
+// fetchWorkerEnv is set to the git directory when gitprompt is started as a
+// background fetch process.
+const fetchWorkerEnv = "GITPROMPT_FETCH_WORKER"
 
+const defaultFormat = "#{frame}([@b#{branch}%h][#{staged} ›%s][#{behind} ↓%b][#{ahead} ↑%a][#{conflicts} x%c][#{modified} +%m][#{untracked} %u]#{frame}) "
+
+// formatFlag is a format that defaults to the environment variable env, or
+// else def.
 type formatFlag struct {
 	set   bool
 	value string
+	env   string
+	def   string
 }
 
 func (f *formatFlag) Set(v string) error {
@@ -33,11 +43,114 @@ func (f *formatFlag) String() string {
 		return f.value
 	}
 
-	if envVar := os.Getenv("GITPROMPT_FORMAT"); envVar != "" {
+	if envVar := os.Getenv(f.env); envVar != "" {
 		return envVar
 	}
 
-	return defaultFormat
+	return f.def
+}
+
+type shellFlag struct {
+	shell gitprompt.Shell
+}
+
+func (f *shellFlag) Set(v string) error {
+	shell, ok := gitprompt.ShellByName(v)
+	if !ok {
+		return fmt.Errorf("unknown shell %q", v)
+	}
+	f.shell = shell
+	return nil
+}
+
+func (f *shellFlag) String() string {
+	return f.shell.String()
+}
+
+type outputFlag struct {
+	output gitprompt.Output
+}
+
+func (f *outputFlag) Set(v string) error {
+	output, ok := gitprompt.OutputByName(v)
+	if !ok {
+		return fmt.Errorf("unknown output %q", v)
+	}
+	f.output = output
+	return nil
+}
+
+func (f *outputFlag) String() string {
+	return f.output.String()
+}
+
+// forgesFlag adds host=label pairs to the default forge labels.
+type forgesFlag struct {
+	forges map[string]string
+}
+
+func (f *forgesFlag) Set(v string) error {
+	parts := strings.SplitN(v, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return fmt.Errorf("expected host=label, got %q", v)
+	}
+	if f.forges == nil {
+		f.forges = map[string]string{}
+		for host, label := range gitprompt.DefaultForges {
+			f.forges[host] = label
+		}
+	}
+	f.forges[strings.ToLower(parts[0])] = parts[1]
+	return nil
+}
+
+func (f *forgesFlag) String() string {
+	return ""
+}
+
+// rewritesFlag adds branch rewrite rules, prefix rules if prefix is set.
+// Both flags share the rules to keep them in order.
+type rewritesFlag struct {
+	rules  *[]gitprompt.BranchRewrite
+	prefix bool
+}
+
+func (f *rewritesFlag) Set(v string) error {
+	parse := gitprompt.ParseBranchRewrite
+	if f.prefix {
+		parse = gitprompt.ParseBranchPrefix
+	}
+	rule, err := parse(v)
+	if err != nil {
+		return err
+	}
+	*f.rules = append(*f.rules, rule)
+	return nil
+}
+
+func (f *rewritesFlag) String() string {
+	return ""
+}
+
+// fallbackFlags hold the formats printed instead of the status when it can't
+// be parsed.
+type fallbackFlags struct {
+	notRepo string
+	noGit   string
+	unsafe  string
+	err     string
+}
+
+func (f *fallbackFlags) format(err error) string {
+	switch err {
+	case gitprompt.ErrNotRepository:
+		return f.notRepo
+	case gitprompt.ErrGitNotFound:
+		return f.noGit
+	case gitprompt.ErrUnsafeRepository:
+		return f.unsafe
+	}
+	return f.err
 }
 
 func showHelp() {
@@ -74,10 +187,33 @@ func showHelp() {
     %%b  Number of commits behind remote
     %%a  Number of commits ahead of remote
     %%c  Number of conflicts
+    %%x  Number of conflicts modified by both sides
+    %%n  Number of conflicts added by both sides
+    %%v  Number of conflicts deleted by one side and modified by the other
+    %%R  Number of other conflicts (deleted by both, added by one side)
     %%m  Number of files modified
     %%u  Number of untracked files
     %%S  Number of stashed changes
+    %%B  Number of stashed changes created on the current branch
+    %%A  Time since the newest stash
+    %%M  Message of the newest stash
     %%U  Name of tracked upstream branch
+    %%f  Time since the last fetch
+    %%r  Name of the repository's top-level directory
+    %%p  Current directory relative to the top-level directory
+    %%i  Number of inserted lines not staged
+    %%d  Number of deleted lines not staged
+    %%j  Number of inserted lines staged
+    %%k  Number of deleted lines staged
+    %%T  Number of sparse-checkout patterns
+    %%w  Number of skip-worktree files
+    %%q  Number of assume-unchanged files
+    %%Q  Number of unpushed fixup!, squash!, amend! and WIP commits
+    %%E  Host of the remote
+    %%J  Owner of the repository on the remote
+    %%V  Name of the repository on the remote
+    %%Z  Web URL of the repository on the remote
+    %%G  Label of the remote's host (see -forge)
 
   Enablers force-enable a group:
     %%C  Enable group when clean
@@ -85,8 +221,39 @@ func showHelp() {
     %%O  Enable group when outdated
     %%L  Enable group when latest (or up to date)
     %%l  Enable group when there's no upstream (local repository)
+    %%o  Enable group when the repository is owned by someone else
+    %%N  Enable group when the branch has no commits yet (unborn)
+    %%g  Enable group when the upstream branch is gone
+    %%F  Enable group when the last fetch is stale (see -stale-fetch)
+    %%P  Enable group when a background fetch is in progress
+    %%X  Enable group when the last background fetch failed
+    %%z  Enable group when the diff is large (see -large-diff)
+    %%y  Enable group when the repository is a shallow clone
+    %%Y  Enable group when the repository is a partial clone
+    %%t  Enable group when sparse-checkout is enabled
+    %%W  Enable group when skip-worktree or assume-unchanged files exist
+    %%K  Enable group when unpushed fixup!, squash!, amend! or WIP commits exist
     %%e  Enable group when last group was not enabled
 
+  Long tokens:
+    %%{name}            Long form of a data token or enabler, e.g. %%{head}
+    %%{head:N,M}        Current branch truncated to N cells, M is end or middle
+    %%{head-colon:N,M}  Like %%{head:N,M}, SHA1 prefixed by :
+    %%{sha:N}           First N hex-digits of SHA1 (default 7)
+    %%{fetch-age:N}     Time since the last fetch in N units, e.g. 2d5h
+    %%{stash-age:N}     Time since the newest stash in N units
+    %%{both-deleted}    Number of conflicts deleted by both sides
+    %%{added-by-us}     Number of conflicts added by us
+    %%{added-by-them}   Number of conflicts added by them
+    %%{deleted-by-us}   Number of conflicts deleted by us
+    %%{deleted-by-them} Number of conflicts deleted by them
+
+  Counts take number formats as arguments, e.g. %%{untracked:99,si}:
+    N    Cap the count at N, larger counts end in +
+    si   Shorten counts of 1000 and more, e.g. 1.5k
+    sup  Print superscript digits
+    sub  Print subscript digits
+
   Colors:
     #k  Black
     #r  Red
@@ -104,6 +271,9 @@ func showHelp() {
     #M  Highlight Magenta
     #C  Highlight Cyan
     #W  Highlight White
+    #{N}        Color N of the 256 color palette
+    #{#rrggbb}  24-bit color
+    #{name}     Color of the palette slot in the theme (see -theme)
     #_  Reset color
     #>  Leak color
 
@@ -114,20 +284,70 @@ func showHelp() {
     @F  Clear faint/dim color
     @i  Set italic
     @I  Clear italic
+    @u  Set underline
+    @d  Set double underline
+    @c  Set curly underline
+    @{N}        Set underline color N of the 256 color palette
+    @{#rrggbb}  Set 24-bit underline color
+    @U  Clear underline and underline color
+    @r  Set reverse video
+    @R  Clear reverse video
+    @s  Set strikethrough
+    @S  Clear strikethrough
+    @o  Set overline
+    @O  Clear overline
+    @k  Set blink
+    @K  Clear blink
     @_  Reset attributes
     @>  Leak attributes
 
+  Links (OSC 8 hyperlinks, see %%Z):
+    &r  Link to the repository
+    &b  Link to the current branch
+    &c  Link to the current commit
+    &_  End link
+
+  The -title format supports the same tokens, colors and links are left out.
+
 `, defaultFormat, example)
 }
 
 func main() {
 
-	var format formatFlag
+	format := formatFlag{env: "GITPROMPT_FORMAT", def: defaultFormat}
+	title := formatFlag{env: "GITPROMPT_TITLE"}
+	theme := formatFlag{env: "GITPROMPT_THEME", def: "default"}
 
 	v := flag.Bool("version", false, "Print version information")
-	zsh := flag.Bool("zsh", false, "Print zsh width control characters")
+	var shell shellFlag
+	flag.Var(&shell, "shell", "Escape data for the shell: none, zsh, bash or fish")
+	var output outputFlag
+	flag.Var(&output, "output", "Print colors and attributes as: ansi, tmux or plain")
+	var color colorFlag
+	flag.Var(&color, "color", "Colors to print: auto, always, never, 16, 256 or truecolor")
+	noReset := flag.Bool("no-reset", false, "Reset only the colors and attributes that were set, keeping the prompt's own")
+	zsh := flag.Bool("zsh", false, "Print zsh width control characters (same as -shell=zsh)")
+	safe := flag.Bool("safe", true, "Don't let git run programs configured in the repository")
+	allowUnsafe := flag.Bool("allow-unsafe", false, "Show the status of repositories owned by someone else in safe mode")
+	fetch := flag.Duration("fetch", 0, "Fetch in the background when the last fetch is older than this (0 disables)")
+	staleFetch := flag.Duration("stale-fetch", gitprompt.DefaultStaleFetch, "Age after which the last fetch is stale")
+	largeDiff := flag.Int("large-diff", gitprompt.DefaultLargeDiff, "Number of changed lines above which the diff is large")
+	pathSegments := flag.Int("path-segments", 0, "Number of trailing segments of %p to print in full (0 prints all)")
+	pathAbbrev := flag.Bool("path-abbrev", false, "Abbreviate leading segments of %p to their first letter instead of omitting them")
+	var forges forgesFlag
+	flag.Var(&forges, "forge", "Label printed by %G for a host and its subdomains, as host=label (repeatable)")
+	var rewrites []gitprompt.BranchRewrite
+	flag.Var(&rewritesFlag{rules: &rewrites, prefix: true}, "branch-prefix", "Replace a prefix of %h, as prefix=replacement, e.g. feature/=f/ (repeatable)")
+	flag.Var(&rewritesFlag{rules: &rewrites}, "branch-rewrite", "Rewrite %h with a regexp, as regexp=replacement, \\= is an = in the regexp (repeatable)")
+	var fallbacks fallbackFlags
+	flag.StringVar(&fallbacks.notRepo, "fallback-not-repo", "", "Format printed outside of git repositories")
+	flag.StringVar(&fallbacks.noGit, "fallback-no-git", "", "Format printed if git is not installed")
+	flag.StringVar(&fallbacks.unsafe, "fallback-unsafe", "", "Format printed for a repository owned by someone else (see -allow-unsafe)")
+	flag.StringVar(&fallbacks.err, "fallback-error", "", "Format printed if git fails for any other reason")
 	flag.Usage = showHelp
 	flag.Var(&format, "format", "Define output format (see below)")
+	flag.Var(&theme, "theme", "Theme for #{name} colors: default, mono, solarized, nord, gruvbox or a file (default $GITPROMPT_THEME)")
+	flag.Var(&title, "title", "Set the terminal title to this format, without colors (default $GITPROMPT_TITLE)")
 	flag.Parse()
 
 	if *v {
@@ -137,17 +357,90 @@ func main() {
 		os.Exit(0)
 	}
 
-	s, err := gitprompt.Parse()
+	parseOpts := gitprompt.ParseOptions{
+		Trusted:     !*safe,
+		AllowUnsafe: *allowUnsafe,
+		Details:     gitprompt.FormatDetails(format.String()) | gitprompt.FormatDetails(title.String()),
+	}
+
+	if gitDir := os.Getenv(fetchWorkerEnv); gitDir != "" {
+		if err := gitprompt.Fetch(gitDir, parseOpts); err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *zsh {
+		shell.shell = gitprompt.ShellZsh
+	}
+
+	palette, err := loadTheme(theme.String())
 	if err != nil {
-		if !*zsh {
+		// The prompt is still printed, with the default theme if it
+		// couldn't be loaded.
+		fmt.Fprintln(os.Stderr, err)
+	}
+
+	colors, out := color.support(output.output)
+	opts := gitprompt.PrintOptions{
+		Shell:          shell.shell,
+		Colors:         colors,
+		Theme:          palette,
+		Output:         out,
+		NoReset:        *noReset,
+		StaleFetch:     *staleFetch,
+		PathSegments:   *pathSegments,
+		PathAbbrev:     *pathAbbrev,
+		LargeDiff:      *largeDiff,
+		Forges:         forges.forges,
+		BranchRewrites: rewrites,
+	}
+
+	s, err := gitprompt.ParseWith(parseOpts)
+	if err != nil {
+		// Fallbacks are formats without data, printed for an empty status.
+		// %o still works in -fallback-unsafe.
+		empty := &gitprompt.GitStatus{Unsafe: err == gitprompt.ErrUnsafeRepository}
+		fmt.Print(gitprompt.PrintWith(empty, fallbacks.format(err), opts))
+		if err == gitprompt.ErrNotRepository {
+			return
+		}
+		if shell.shell != gitprompt.ShellZsh {
 			fmt.Fprintln(os.Stderr, err)
 		}
 		os.Exit(1)
 	}
-	if s == nil {
-		return
+
+	if *fetch > 0 && gitprompt.FetchDue(s, *fetch) {
+		// Best effort, the prompt is printed regardless.
+		_ = startFetch(s.GitDir)
+	}
+
+	if title.String() != "" {
+		fmt.Print(gitprompt.PrintTitle(s, title.String(), opts))
 	}
+	fmt.Print(gitprompt.PrintWith(s, format.String(), opts))
 
-	fmt.Print(gitprompt.Print(s, format.String(), *zsh))
+}
 
+// startFetch starts a detached gitprompt process with the same flags that
+// fetches the repository in gitDir. It does not wait for the fetch to
+// complete.
+func startFetch(gitDir string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Dir = gitDir
+	cmd.Env = append(os.Environ(),
+		fetchWorkerEnv+"="+gitDir,
+		// Never wait for credentials, there's nobody to enter them.
+		"GIT_TERMINAL_PROMPT=0",
+	)
+	detach(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	return cmd.Process.Release()
 }
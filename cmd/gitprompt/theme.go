@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/akupila/gitprompt"
+)
+
+// loadTheme returns the theme with the name: a built-in theme, a file in
+// the themes directory of the config directory or a path to a file. Slots in
+// GITPROMPT_PALETTE, e.g. "branch=R,dirty=#ff0000", override the theme's.
+// Invalid slots are skipped, the theme is returned with the error of the first
+// one.
+func loadTheme(name string) (gitprompt.Theme, error) {
+	theme := gitprompt.Theme{}
+	if builtin, ok := gitprompt.Themes[name]; ok {
+		for slot, c := range builtin {
+			theme[slot] = c
+		}
+	} else {
+		path := name
+		if !strings.ContainsRune(name, os.PathSeparator) {
+			path = filepath.Join(configDir(), "themes", name)
+		}
+		f, err := os.Open(path)
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("unknown theme %q", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if theme, err = gitprompt.ParseTheme(f); err != nil {
+			return nil, fmt.Errorf("theme %s: %v", path, err)
+		}
+	}
+	var paletteErr error
+	if palette := os.Getenv("GITPROMPT_PALETTE"); palette != "" {
+		for _, def := range strings.Split(palette, ",") {
+			if err := theme.Set(def); err != nil && paletteErr == nil {
+				paletteErr = fmt.Errorf("GITPROMPT_PALETTE: %v", err)
+			}
+		}
+	}
+	return theme, paletteErr
+}
+
+// configDir returns gitprompt's config directory, $XDG_CONFIG_HOME/gitprompt
+// or ~/.config/gitprompt.
+func configDir() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		dir = filepath.Join(os.Getenv("HOME"), ".config")
+	}
+	return filepath.Join(dir, "gitprompt")
+}
@@ -0,0 +1,205 @@
+package gitprompt
+
+import (
+	"strconv"
+	"strings"
+)
+
+// color is a foreground color: an ANSI SGR code such as 31 for red, an
+// index in the 256 color palette or a 24-bit RGB color. The kind is stored in
+// the top byte. Zero is the default color.
+type color uint32
+
+const (
+	colorIndexed color = 1 << 24
+	colorRGB     color = 2 << 24
+	colorKind    color = 0xff << 24
+)
+
+func indexedColor(i uint8) color {
+	return colorIndexed | color(i)
+}
+
+// rgb is a 24-bit color's red, green and blue components.
+type rgb [3]uint8
+
+func rgbColor(c rgb) color {
+	return colorRGB | color(c[0])<<16 | color(c[1])<<8 | color(c[2])
+}
+
+func (c color) rgb() rgb {
+	return rgb{uint8(c >> 16), uint8(c >> 8), uint8(c)}
+}
+
+// sgr returns the SGR parameters that set the color.
+func (c color) sgr() string {
+	switch c & colorKind {
+	case colorIndexed:
+		return "38;5;" + strconv.Itoa(int(uint8(c)))
+	case colorRGB:
+		v := c.rgb()
+		return "38;2;" + strconv.Itoa(int(v[0])) + ";" + strconv.Itoa(int(v[1])) + ";" + strconv.Itoa(int(v[2]))
+	}
+	if c == 0 {
+		// The default color, 0 would reset attributes too.
+		return "39"
+	}
+	return strconv.Itoa(int(c))
+}
+
+// underlineSGR returns the SGR parameters that set the underline color,
+// which has no codes for the basic colors.
+func (c color) underlineSGR() string {
+	switch {
+	case c&colorKind != 0:
+		return "58" + c.sgr()[2:]
+	case c >= 30 && c <= 37:
+		return "58;5;" + strconv.Itoa(int(c-30))
+	case c >= 90 && c <= 97:
+		return "58;5;" + strconv.Itoa(int(c-90+8))
+	}
+	return "59"
+}
+
+// ColorSupport is the range of colors the terminal can display. Colors in
+// the format are mapped to the nearest supported color.
+type ColorSupport int
+
+// Supported color ranges.
+const (
+	// ColorTrue prints colors as-is, including 24-bit colors.
+	ColorTrue ColorSupport = iota
+	// Color256 maps 24-bit colors to the 256 color palette.
+	Color256
+	// Color16 maps colors to the 16 ANSI colors.
+	Color16
+	// ColorNone prints no colors. Attributes are still printed.
+	ColorNone
+)
+
+// convert maps c to the nearest color in the range, or returns false if no
+// colors are supported.
+func (cs ColorSupport) convert(c color) (color, bool) {
+	switch cs {
+	case ColorNone:
+		return 0, false
+	case Color256:
+		if c&colorKind == colorRGB {
+			return indexedColor(nearestIndexed(c.rgb())), true
+		}
+	case Color16:
+		switch c & colorKind {
+		case colorIndexed:
+			return ansiColor(nearestANSI(paletteRGB(uint8(c)))), true
+		case colorRGB:
+			return ansiColor(nearestANSI(c.rgb())), true
+		}
+	}
+	return c, true
+}
+
+// ansiColor returns the SGR code of the first 16 palette colors.
+func ansiColor(i uint8) color {
+	if i < 8 {
+		return color(30 + i)
+	}
+	return color(90 + i - 8)
+}
+
+// ansiRGB are the xterm defaults of the first 16 palette colors.
+var ansiRGB = [16]rgb{
+	{0, 0, 0}, {205, 0, 0}, {0, 205, 0}, {205, 205, 0},
+	{0, 0, 238}, {205, 0, 205}, {0, 205, 205}, {229, 229, 229},
+	{127, 127, 127}, {255, 0, 0}, {0, 255, 0}, {255, 255, 0},
+	{92, 92, 255}, {255, 0, 255}, {0, 255, 255}, {255, 255, 255},
+}
+
+// cubeLevels are the component values of the 6x6x6 color cube (16-231).
+var cubeLevels = [6]uint8{0, 95, 135, 175, 215, 255}
+
+// paletteRGB returns the RGB value of a 256 color palette index.
+func paletteRGB(i uint8) rgb {
+	switch {
+	case i < 16:
+		return ansiRGB[i]
+	case i < 232:
+		i -= 16
+		return rgb{cubeLevels[i/36], cubeLevels[i/6%6], cubeLevels[i%6]}
+	}
+	v := 8 + 10*(i-232)
+	return rgb{v, v, v}
+}
+
+// nearestIndexed returns the nearest color in the cube or the grayscale ramp
+// (232-255) of the 256 color palette. The first 16 colors are skipped, their
+// values vary between terminals.
+func nearestIndexed(c rgb) uint8 {
+	cube := 16 + 36*nearestLevel(c[0]) + 6*nearestLevel(c[1]) + nearestLevel(c[2])
+	gray := uint8(232)
+	if avg := (int(c[0]) + int(c[1]) + int(c[2])) / 3; avg > 238 {
+		gray = 255
+	} else if avg > 8 {
+		gray += uint8((avg - 8 + 5) / 10)
+	}
+	if distance(c, paletteRGB(gray)) < distance(c, paletteRGB(cube)) {
+		return gray
+	}
+	return cube
+}
+
+func nearestLevel(v uint8) uint8 {
+	best := 0
+	for i, level := range cubeLevels {
+		if abs(int(v)-int(level)) < abs(int(v)-int(cubeLevels[best])) {
+			best = i
+		}
+	}
+	return uint8(best)
+}
+
+// nearestANSI returns the index of the nearest of the first 16 colors.
+func nearestANSI(c rgb) uint8 {
+	best := 0
+	for i, a := range ansiRGB {
+		if distance(c, a) < distance(c, ansiRGB[best]) {
+			best = i
+		}
+	}
+	return uint8(best)
+}
+
+// distance returns the squared distance between two colors.
+func distance(a, b rgb) int {
+	d := 0
+	for i := range a {
+		d += (int(a[i]) - int(b[i])) * (int(a[i]) - int(b[i]))
+	}
+	return d
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
+
+// parseColor parses an extended color token's name: a palette index from 0
+// to 255 or #rrggbb.
+func parseColor(name string) (color, bool) {
+	if strings.HasPrefix(name, "#") {
+		if len(name) != 7 {
+			return 0, false
+		}
+		v, err := strconv.ParseUint(name[1:], 16, 32)
+		if err != nil {
+			return 0, false
+		}
+		return rgbColor(rgb{uint8(v >> 16), uint8(v >> 8), uint8(v)}), true
+	}
+	i, err := strconv.ParseUint(name, 10, 8)
+	if err != nil {
+		return 0, false
+	}
+	return indexedColor(uint8(i)), true
+}
@@ -0,0 +1,57 @@
+package gitprompt
+
+import (
+	"testing"
+)
+
+func TestParseColor(t *testing.T) {
+	tests := map[string]color{
+		"0":       indexedColor(0),
+		"255":     indexedColor(255),
+		"#ff8000": rgbColor(rgb{255, 128, 0}),
+		"#FF8000": rgbColor(rgb{255, 128, 0}),
+	}
+	for name, expected := range tests {
+		actual, ok := parseColor(name)
+		if !ok || actual != expected {
+			t.Errorf("%q: expected %x, got %x (%v)", name, expected, actual, ok)
+		}
+	}
+	for _, name := range []string{"", "256", "-1", "#fff", "#gggggg", "red"} {
+		if _, ok := parseColor(name); ok {
+			t.Errorf("%q: expected invalid color", name)
+		}
+	}
+}
+
+func TestConvertColor(t *testing.T) {
+	tests := []struct {
+		support  ColorSupport
+		color    color
+		expected string
+	}{
+		{ColorTrue, rgbColor(rgb{255, 128, 0}), "38;2;255;128;0"},
+		{ColorTrue, indexedColor(208), "38;5;208"},
+		{Color256, rgbColor(rgb{255, 128, 0}), "38;5;208"},
+		{Color256, rgbColor(rgb{128, 128, 128}), "38;5;244"},
+		{Color256, rgbColor(rgb{0, 0, 0}), "38;5;16"},
+		{Color256, colors['r'], "31"},
+		{Color16, rgbColor(rgb{255, 128, 0}), "33"},
+		{Color16, rgbColor(rgb{250, 10, 10}), "91"},
+		{Color16, indexedColor(4), "34"},
+		{Color16, indexedColor(12), "94"},
+		{Color16, indexedColor(38), "36"},
+		{Color16, colors['R'], "91"},
+	}
+	for _, test := range tests {
+		actual, ok := test.support.convert(test.color)
+		if !ok {
+			t.Errorf("%x: not supported", test.color)
+			continue
+		}
+		assertString(t, test.color.sgr(), test.expected, actual.sgr())
+	}
+	if _, ok := ColorNone.convert(colors['r']); ok {
+		t.Error("ColorNone supports colors")
+	}
+}
@@ -0,0 +1,61 @@
+package gitprompt
+
+import (
+	"errors"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrNotRepository is returned if the current directory is not part of
+	// a git working tree.
+	ErrNotRepository = errors.New("not a git repository")
+	// ErrGitNotFound is returned if the git executable cannot be found.
+	ErrGitNotFound = errors.New("git not found")
+	// ErrUnsafeRepository is returned if git refuses to work in a repository
+	// owned by someone else, see safe.directory in git-config(1).
+	ErrUnsafeRepository = errors.New("repository is owned by someone else")
+	// ErrUnsafeRemote is returned by Fetch in safe mode if a remote's URL
+	// needs a remote helper, which can run any program.
+	ErrUnsafeRemote = errors.New("remote URL needs a remote helper")
+)
+
+// GitError is returned if git fails for any other reason.
+type GitError struct {
+	Args     []string
+	ExitCode int
+	Stderr   string
+}
+
+func (e *GitError) Error() string {
+	if msg := strings.TrimSpace(e.Stderr); msg != "" {
+		return msg
+	}
+	return "git exited with status " + strconv.Itoa(e.ExitCode)
+}
+
+// gitError converts an error from running git to one of the typed errors.
+func gitError(err error, args []string, stderr string) error {
+	switch e := err.(type) {
+	case *exec.Error:
+		if e.Err == exec.ErrNotFound {
+			return ErrGitNotFound
+		}
+		return err
+	case *exec.ExitError:
+		switch {
+		case strings.Contains(stderr, "not a git repository"),
+			strings.Contains(stderr, "must be run in a work tree"):
+			return ErrNotRepository
+		case strings.Contains(stderr, "detected dubious ownership"):
+			return ErrUnsafeRepository
+		}
+		return &GitError{
+			Args:     args,
+			ExitCode: e.ExitCode(),
+			Stderr:   stderr,
+		}
+	}
+	return err
+}
@@ -0,0 +1,159 @@
+package gitprompt
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// fetchLockFile is held in the git directory while a fetch is running.
+	fetchLockFile = "gitprompt-fetch.lock"
+	// fetchResultFile records the time and error of the last fetch attempt.
+	fetchResultFile = "gitprompt-fetch"
+	// fetchedFile records the time of the last successful fetch. Failed
+	// fetches truncate FETCH_HEAD, which loses it.
+	fetchedFile = "gitprompt-fetched"
+	// fetchLockTimeout is the age after which a lock is considered abandoned,
+	// e.g. because the fetching process was killed. Running fetches keep
+	// their lock fresh.
+	fetchLockTimeout = 10 * time.Minute
+)
+
+// ErrFetchInProgress is returned by Fetch if another fetch is running for the
+// same repository.
+var ErrFetchInProgress = errors.New("fetch already in progress")
+
+// FetchDue reports whether a background fetch should be started for the
+// repository: no fetch is running and neither the last fetch nor the last
+// fetch attempt happened within interval.
+func FetchDue(s *GitStatus, interval time.Duration) bool {
+	if s.GitDir == "" || s.Fetching || s.Unsafe {
+		return false
+	}
+	if s.Fetched && s.FetchAge < interval {
+		return false
+	}
+	info, err := os.Stat(filepath.Join(s.GitDir, fetchResultFile))
+	if err == nil && time.Since(info.ModTime()) < interval {
+		return false
+	}
+	return true
+}
+
+// Fetch runs git fetch for the repository in gitDir, in safe mode unless the
+// options say otherwise. A lock file in gitDir prevents concurrent fetches,
+// ErrFetchInProgress is returned if it is held. In safe mode nothing is
+// fetched if a remote needs a remote helper, see ErrUnsafeRemote. The outcome
+// is recorded for the Fetching and FetchFailed status.
+func Fetch(gitDir string, o ParseOptions) error {
+
+	lock := filepath.Join(gitDir, fetchLockFile)
+	if err := acquireLock(lock); err != nil {
+		return err
+	}
+	defer os.Remove(lock)
+	done := make(chan struct{})
+	defer close(done)
+	go refreshLock(lock, done)
+
+	args := []string{"--git-dir", gitDir}
+	if !o.Trusted {
+		configFile, err := gitConfigFile(gitDir)
+		if err != nil {
+			return err
+		}
+		args = append(args, safeConfig(args, configFile, filepath.Join(gitDir, "config.worktree"))...)
+	}
+
+	var fetchErr error
+	if o.Trusted {
+		_, fetchErr = runGit(args, "fetch", "--quiet")
+	} else if fetchErr = checkRemotes(args); fetchErr == nil {
+		// Submodules have their own config, which isn't made safe.
+		_, fetchErr = runGit(args, "fetch", "--quiet", "--no-recurse-submodules")
+	}
+
+	var result []byte
+	if fetchErr != nil {
+		result = []byte(fetchErr.Error())
+	}
+	if err := ioutil.WriteFile(filepath.Join(gitDir, fetchResultFile), result, 0644); err != nil {
+		return err
+	}
+	if fetchErr == nil {
+		fetched := filepath.Join(gitDir, fetchedFile)
+		if err := ioutil.WriteFile(fetched, nil, 0644); err != nil {
+			return err
+		}
+		// Truncating an empty file doesn't always update its time.
+		now := time.Now()
+		if err := os.Chtimes(fetched, now, now); err != nil {
+			return err
+		}
+	}
+
+	return fetchErr
+
+}
+
+// acquireLock creates the lock file. A lock older than fetchLockTimeout was
+// abandoned and is taken over: it's renamed first so that only one process
+// can take it over, and put back if it turns out to be fresh because another
+// process took it over in the meantime.
+func acquireLock(lock string) error {
+	err := createLock(lock)
+	if !os.IsExist(err) {
+		return err
+	}
+	if info, err := os.Stat(lock); err != nil || time.Since(info.ModTime()) < fetchLockTimeout {
+		return ErrFetchInProgress
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(lock), filepath.Base(lock)+".")
+	if err != nil {
+		return err
+	}
+	stale := tmp.Name()
+	tmp.Close()
+	defer os.Remove(stale)
+	if err := os.Rename(lock, stale); err != nil {
+		// Another process took it over.
+		return ErrFetchInProgress
+	}
+	if info, err := os.Stat(stale); err == nil && time.Since(info.ModTime()) < fetchLockTimeout {
+		_ = os.Link(stale, lock)
+		return ErrFetchInProgress
+	}
+	if err := createLock(lock); err != nil {
+		if os.IsExist(err) {
+			return ErrFetchInProgress
+		}
+		return err
+	}
+	return nil
+}
+
+func createLock(lock string) error {
+	f, err := os.OpenFile(lock, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// refreshLock keeps the lock from looking abandoned while a fetch runs for
+// longer than fetchLockTimeout, until done is closed.
+func refreshLock(lock string, done <-chan struct{}) {
+	ticker := time.NewTicker(fetchLockTimeout / 10)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			_ = os.Chtimes(lock, now, now)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package gitprompt
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func setupFetchTest(t *testing.T) (*GitStatus, func()) {
+	dir, cleanupDir := setupTestDir(t)
+	remote, cleanupRemote := setupRemote(t, dir)
+
+	setupCommands(t, dir, `
+		git init --initial-branch=master || git init
+		git remote add origin `+remote+`
+		git commit --allow-empty -m 'initial'
+		git push -u origin HEAD
+		other=$(mktemp -d)
+		git clone `+remote+` $other
+		git -C $other commit --allow-empty -m 'second'
+		git -C $other push
+		rm -rf $other
+	`)
+
+	s, err := Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, func() {
+		cleanupRemote()
+		cleanupDir()
+	}
+}
+
+func TestFetch(t *testing.T) {
+	s, done := setupFetchTest(t)
+	defer done()
+
+	assertInt(t, "Behind", 0, s.Behind)
+	assertBool(t, "FetchDue", true, FetchDue(s, time.Hour))
+
+	if err := Fetch(s.GitDir, ParseOptions{}); err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+
+	s, _ = Parse()
+	assertInt(t, "Behind", 1, s.Behind)
+	assertBool(t, "Fetched", true, s.Fetched)
+	assertBool(t, "Fetching", false, s.Fetching)
+	assertBool(t, "FetchFailed", false, s.FetchFailed)
+	assertBool(t, "FetchDue", false, FetchDue(s, time.Hour))
+	if _, err := os.Stat(filepath.Join(s.GitDir, fetchLockFile)); !os.IsNotExist(err) {
+		t.Errorf("Expected lock to be released, got %v", err)
+	}
+}
+
+func TestFetchLocked(t *testing.T) {
+	s, done := setupFetchTest(t)
+	defer done()
+
+	lock := filepath.Join(s.GitDir, fetchLockFile)
+	if err := ioutil.WriteFile(lock, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, _ = Parse()
+	assertBool(t, "Fetching", true, s.Fetching)
+	assertBool(t, "FetchDue", false, FetchDue(s, time.Hour))
+	if err := Fetch(s.GitDir, ParseOptions{}); err != ErrFetchInProgress {
+		t.Errorf("Expected ErrFetchInProgress, got %v", err)
+	}
+
+	// Abandoned locks are taken over.
+	old := time.Now().Add(-2 * fetchLockTimeout)
+	if err := os.Chtimes(lock, old, old); err != nil {
+		t.Fatal(err)
+	}
+	s, _ = Parse()
+	assertBool(t, "Fetching", false, s.Fetching)
+	if err := Fetch(s.GitDir, ParseOptions{}); err != nil {
+		t.Errorf("Fetch: %v", err)
+	}
+}
+
+func TestAcquireLockTakeover(t *testing.T) {
+	dir, done := setupTestDir(t)
+	defer done()
+
+	lock := filepath.Join(dir, fetchLockFile)
+	if err := ioutil.WriteFile(lock, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * fetchLockTimeout)
+	if err := os.Chtimes(lock, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only one of the processes that find the abandoned lock takes it over.
+	errs := make(chan error)
+	for i := 0; i < 10; i++ {
+		go func() { errs <- acquireLock(lock) }()
+	}
+	acquired := 0
+	for i := 0; i < 10; i++ {
+		switch err := <-errs; err {
+		case nil:
+			acquired++
+		case ErrFetchInProgress:
+		default:
+			t.Errorf("acquireLock: %v", err)
+		}
+	}
+	assertInt(t, "acquired", 1, acquired)
+	if info, err := os.Stat(lock); err != nil || time.Since(info.ModTime()) > time.Minute {
+		t.Errorf("Expected a fresh lock, got %v", err)
+	}
+	files, _ := filepath.Glob(lock + ".*")
+	assertInt(t, "renamed locks", 0, len(files))
+}
+
+func TestFetchFailed(t *testing.T) {
+	s, done := setupFetchTest(t)
+	defer done()
+
+	setupCommands(t, s.GitDir, `
+		git remote set-url origin /nonexistent
+	`)
+
+	if err := Fetch(s.GitDir, ParseOptions{}); err == nil {
+		t.Errorf("Expected fetch to fail")
+	}
+
+	s, _ = Parse()
+	assertBool(t, "FetchFailed", true, s.FetchFailed)
+	assertBool(t, "FetchDue", false, FetchDue(s, time.Hour))
+	assertBool(t, "FetchDue", true, FetchDue(s, 0))
+}
+
+func TestFetchUnsafeRemote(t *testing.T) {
+	s, done := setupFetchTest(t)
+	defer done()
+
+	marker := filepath.Join(s.GitDir, "pwned")
+	for _, config := range []string{
+		`git remote set-url origin "ext::sh -c touch% ` + marker + `"`,
+		`git remote set-url origin https://example.com/repo.git
+		git config url."ext::sh -c touch% ` + marker + ` #".insteadOf https://example.com/`,
+	} {
+		setupCommands(t, s.GitDir, `
+			git config protocol.ext.allow always
+			`+config+`
+		`)
+		if err := Fetch(s.GitDir, ParseOptions{}); err != ErrUnsafeRemote {
+			t.Errorf("Expected ErrUnsafeRemote, got %v", err)
+		}
+		if _, err := os.Stat(marker); err == nil {
+			t.Fatalf("Expected remote helper not to run in safe mode")
+		}
+	}
+
+	s, _ = Parse()
+	assertBool(t, "FetchFailed", true, s.FetchFailed)
+}
+
+func TestFetchFailedKeepsAge(t *testing.T) {
+	s, done := setupFetchTest(t)
+	defer done()
+
+	if err := Fetch(s.GitDir, ParseOptions{}); err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	for _, file := range []string{fetchedFile, "FETCH_HEAD"} {
+		if err := os.Chtimes(filepath.Join(s.GitDir, file), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	setupCommands(t, s.GitDir, `
+		git remote set-url origin /nonexistent
+	`)
+	if err := Fetch(s.GitDir, ParseOptions{}); err == nil {
+		t.Errorf("Expected fetch to fail")
+	}
+
+	s, _ = Parse()
+	assertBool(t, "Fetched", true, s.Fetched)
+	assertBool(t, "FetchFailed", true, s.FetchFailed)
+	if s.FetchAge < 2*time.Hour || s.FetchAge > 3*time.Hour {
+		t.Errorf("Expected the age of the last successful fetch, got %v", s.FetchAge)
+	}
+}
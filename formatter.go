@@ -2,18 +2,57 @@ package gitprompt
 
 import (
 	"bytes"
-	"strconv"
 	"strings"
 )
 
 type formatter struct {
-	color        uint8
-	currentColor uint8
-	attr         uint8
-	currentAttr  uint8
+	color          color
+	currentColor   color
+	ulColor        color
+	currentUlColor color
+	attr           uint16
+	currentAttr    uint16
+	output         Output
+	// noReset resets colors and attributes one by one instead of resetting
+	// all at once, which also resets styles set outside of the output.
+	noReset bool
 }
 
-func (f *formatter) setColor(c uint8) {
+// Attributes, the bits in formatter.attr.
+const (
+	attrBold uint8 = iota + 1
+	attrFaint
+	attrItalic
+	attrUnderline
+	attrBlink
+	attrReverse
+	attrStrike
+	attrOverline
+	attrDoubleUnderline
+	attrCurlyUnderline
+	attrCount
+)
+
+// attrSGR are the SGR codes that set and reset attributes. Bold and faint
+// share a reset code, as do the underline styles. 21 is double underline, not
+// "bold off", in current terminals.
+var attrSGR = map[uint8]struct{ set, reset string }{
+	attrBold:            {"1", "22"},
+	attrFaint:           {"2", "22"},
+	attrItalic:          {"3", "23"},
+	attrUnderline:       {"4", "24"},
+	attrBlink:           {"5", "25"},
+	attrReverse:         {"7", "27"},
+	attrStrike:          {"9", "29"},
+	attrOverline:        {"53", "55"},
+	attrDoubleUnderline: {"21", "24"},
+	attrCurlyUnderline:  {"4:3", "24"},
+}
+
+// underlines are the underline styles, only one of them is set at a time.
+var underlines = []uint8{attrUnderline, attrDoubleUnderline, attrCurlyUnderline}
+
+func (f *formatter) setColor(c color) {
 	f.color = c
 }
 
@@ -21,66 +60,114 @@ func (f *formatter) clearColor() {
 	f.color = 0
 }
 
+func (f *formatter) setUnderlineColor(c color) {
+	f.ulColor = c
+}
+
 func (f *formatter) setAttribute(a uint8) {
+	if isUnderline(a) {
+		for _, u := range underlines {
+			f.attr &= ^(1 << u)
+		}
+	}
 	f.attr |= (1 << a)
 }
 
+// clearAttribute clears the attribute. Clearing the underline clears all
+// underline styles and the underline color.
 func (f *formatter) clearAttribute(a uint8) {
+	if a == attrUnderline {
+		for _, u := range underlines[1:] {
+			f.attr &= ^(1 << u)
+		}
+		f.ulColor = 0
+	}
 	f.attr &= ^(1 << a)
 }
 
 func (f *formatter) attributeSet(a uint8) bool {
-	return (f.attr & (1 << a)) != 0
+	return attrSetIn(f.attr, a)
 }
 
 func (f *formatter) clearAttributes() {
 	f.attr = 0
+	f.ulColor = 0
+}
+
+func isUnderline(a uint8) bool {
+	for _, u := range underlines {
+		if a == u {
+			return true
+		}
+	}
+	return false
 }
 
 func (f *formatter) printANSI(b *bytes.Buffer) {
-	if f.color == f.currentColor && f.attr == f.currentAttr {
+	if f.color == f.currentColor && f.attr == f.currentAttr && f.ulColor == f.currentUlColor {
+		return
+	}
+	switch f.output {
+	case OutputPlain:
+		return
+	case OutputTmux:
+		f.printTmux(b)
 		return
 	}
 	b.WriteString("\x1b[")
-	if f.color == 0 && f.attr == 0 {
+	if f.color == 0 && f.attr == 0 && f.ulColor == 0 && !f.noReset {
 		// reset all
 		b.WriteString("0m")
 		f.currentColor = 0
 		f.currentAttr = 0
+		f.currentUlColor = 0
 		return
 	}
 	mm := []string{}
-	aAdded, aRemoved := attrDiff(f.currentAttr, f.attr)
-	if len(aRemoved) > 0 {
-		mm = append(mm, "0")
-		var i uint8 = 1
-		for ; i < 8; i++ {
-			if f.attributeSet(i) {
-				mm = append(mm, strconv.Itoa(int(i)))
-			}
+	_, aRemoved := attrDiff(f.currentAttr, f.attr)
+	reset := map[string]bool{}
+	for _, a := range aRemoved {
+		code := attrSGR[a].reset
+		if !reset[code] {
+			mm = append(mm, code)
+			reset[code] = true
 		}
-	} else if len(aAdded) > 0 {
-		for _, a := range aAdded {
-			mm = append(mm, strconv.Itoa(int(a)))
+	}
+	for a := uint8(1); a < attrCount; a++ {
+		// Set attributes that were added or cleared by a shared reset code.
+		if f.attributeSet(a) && (!attrSetIn(f.currentAttr, a) || reset[attrSGR[a].reset]) {
+			mm = append(mm, attrSGR[a].set)
+		}
+	}
+	if f.ulColor != f.currentUlColor {
+		if f.ulColor == 0 {
+			mm = append(mm, "59")
+		} else {
+			mm = append(mm, f.ulColor.underlineSGR())
 		}
 	}
-	if f.color != f.currentColor || len(aRemoved) > 0 {
-		mm = append(mm, strconv.Itoa(int(f.color)))
+	if f.color != f.currentColor {
+		mm = append(mm, f.color.sgr())
 	}
 	b.WriteString(strings.Join(mm, ";"))
 	b.WriteString("m")
 	f.currentColor = f.color
 	f.currentAttr = f.attr
+	f.currentUlColor = f.ulColor
+
+}
 
+func attrSetIn(attr uint16, a uint8) bool {
+	return (attr & (1 << a)) != 0
 }
 
-func attrDiff(a, b uint8) ([]uint8, []uint8) {
+func attrDiff(a, b uint16) ([]uint8, []uint8) {
 	added := []uint8{}
 	removed := []uint8{}
 	var i uint8
-	for ; i < 8; i++ {
-		inA := (a & (1 << i)) != 0
-		inB := (b & (1 << i)) != 0
+	for ; i < attrCount; i++ {
+		inA := attrSetIn(a, i)
+		inB := attrSetIn(b, i)
 		if inA && inB {
 			continue
 		}
@@ -0,0 +1,94 @@
+package gitprompt
+
+import (
+	"strconv"
+	"strings"
+)
+
+// numberFormat is how a count is printed, set by the arguments of its long
+// token, e.g. %{untracked:99,si}.
+type numberFormat struct {
+	// max caps the count, larger counts are printed as max+. Zero doesn't
+	// cap.
+	max int
+	// si prints large counts with SI suffixes, e.g. 1.5k.
+	si bool
+	// digits replace 0-9 and +, e.g. with superscript digits.
+	digits *[11]rune
+}
+
+var (
+	superscript = [11]rune{'⁰', '¹', '²', '³', '⁴', '⁵', '⁶', '⁷', '⁸', '⁹', '⁺'}
+	subscript   = [11]rune{'₀', '₁', '₂', '₃', '₄', '₅', '₆', '₇', '₈', '₉', '₊'}
+)
+
+// siUnits are the suffixes of SI formatted counts, starting at 1000.
+var siUnits = []string{"k", "M", "G"}
+
+// parseNumberFormat parses the arguments of a count: a number to cap it at,
+// si, sup or sub, in any order.
+func parseNumberFormat(args []string) (numberFormat, bool) {
+	var f numberFormat
+	for _, arg := range args {
+		switch arg {
+		case "":
+		case "si":
+			f.si = true
+		case "sup":
+			f.digits = &superscript
+		case "sub":
+			f.digits = &subscript
+		default:
+			max, err := strconv.Atoi(arg)
+			if err != nil || max < 1 {
+				return f, false
+			}
+			f.max = max
+		}
+	}
+	return f, true
+}
+
+// format formats the count i.
+func (f numberFormat) format(i int) string {
+	overflow := f.max > 0 && i > f.max
+	if overflow {
+		i = f.max
+	}
+	s := strconv.Itoa(i)
+	if f.si {
+		s = formatSI(i)
+	}
+	if overflow {
+		s += "+"
+	}
+	if f.digits != nil {
+		s = strings.Map(func(r rune) rune {
+			switch {
+			case r >= '0' && r <= '9':
+				return f.digits[r-'0']
+			case r == '+':
+				return f.digits[10]
+			}
+			return r
+		}, s)
+	}
+	return s
+}
+
+// formatSI formats i with an SI suffix if it's 1000 or more, e.g. 1.5k or
+// 15k. It's rounded down so it never overstates the count.
+func formatSI(i int) string {
+	if i < 1000 {
+		return strconv.Itoa(i)
+	}
+	unit, n := 1000, 0
+	for n < len(siUnits)-1 && i >= unit*1000 {
+		unit *= 1000
+		n++
+	}
+	if tenths := i % unit / (unit / 10); i < 10*unit && tenths > 0 {
+		return strconv.Itoa(i/unit) + "." + strconv.Itoa(tenths) + siUnits[n]
+	}
+	return strconv.Itoa(i/unit) + siUnits[n]
+}
@@ -0,0 +1,49 @@
+package gitprompt
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestNumberFormat(t *testing.T) {
+	tests := []struct {
+		args     string
+		i        int
+		expected string
+	}{
+		{"", 1532, "1532"},
+		{"99", 99, "99"},
+		{"99", 100, "99+"},
+		{"9", 0, "0"},
+		{"si", 999, "999"},
+		{"si", 1000, "1k"},
+		{"si", 1532, "1.5k"},
+		{"si", 1999, "1.9k"},
+		{"si", 10500, "10k"},
+		{"si", 999999, "999k"},
+		{"si", 2050000, "2M"},
+		{"si", 1234567890, "1.2G"},
+		{"999,si", 1532, "999+"},
+		{"si,5000", 7200, "5k+"},
+		{"sup", 1203, "¹²⁰³"},
+		{"sub", 45, "₄₅"},
+		{"sup,9", 12, "⁹⁺"},
+		{"si,sub", 1532, "₁.₅k"},
+		{",si,", 1532, "1.5k"},
+	}
+	for _, test := range tests {
+		f, ok := parseNumberFormat(strings.Split(test.args, ","))
+		if !ok {
+			t.Errorf("%q: invalid", test.args)
+			continue
+		}
+		assertString(t, fmt.Sprintf("%s %d", test.args, test.i), test.expected, f.format(test.i))
+	}
+
+	for _, invalid := range []string{"0", "-1", "x", "99+", "k"} {
+		if _, ok := parseNumberFormat([]string{invalid}); ok {
+			t.Errorf("%q: expected invalid", invalid)
+		}
+	}
+}
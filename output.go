@@ -0,0 +1,114 @@
+package gitprompt
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Output is the kind of markup colors and attributes are printed as.
+type Output int
+
+// Supported outputs.
+const (
+	// OutputANSI prints ANSI escape sequences for terminals.
+	OutputANSI Output = iota
+	// OutputTmux prints tmux style directives such as #[fg=red,bold] for
+	// the tmux status line.
+	OutputTmux
+	// OutputPlain prints no markup, e.g. for the terminal title.
+	OutputPlain
+)
+
+var outputNames = map[string]Output{
+	"ansi":  OutputANSI,
+	"tmux":  OutputTmux,
+	"plain": OutputPlain,
+}
+
+// OutputByName returns the output with the name, one of ansi, tmux or plain.
+func OutputByName(name string) (Output, bool) {
+	out, ok := outputNames[name]
+	return out, ok
+}
+
+func (out Output) String() string {
+	for name, o := range outputNames {
+		if o == out {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+// escape escapes text for the output. tmux interprets # in the status line.
+func (out Output) escape(s string) string {
+	if out == OutputTmux {
+		return strings.Replace(s, "#", "##", -1)
+	}
+	return s
+}
+
+// tmuxColors are the tmux names of the ANSI colors, starting at black (30).
+var tmuxColors = []string{"black", "red", "green", "yellow", "blue", "magenta", "cyan", "white"}
+
+// tmuxAttrs are the tmux names of the attributes.
+var tmuxAttrs = map[uint8]string{
+	attrBold:            "bold",
+	attrFaint:           "dim",
+	attrItalic:          "italics",
+	attrUnderline:       "underscore",
+	attrBlink:           "blink",
+	attrReverse:         "reverse",
+	attrStrike:          "strikethrough",
+	attrOverline:        "overline",
+	attrDoubleUnderline: "double-underscore",
+	attrCurlyUnderline:  "curly-underscore",
+}
+
+// printTmux prints the change from the current to the new color and
+// attributes as a tmux style directive.
+func (f *formatter) printTmux(b *bytes.Buffer) {
+	if f.color == 0 && f.attr == 0 && f.ulColor == 0 && !f.noReset {
+		b.WriteString("#[default]")
+		f.currentColor = 0
+		f.currentAttr = 0
+		f.currentUlColor = 0
+		return
+	}
+	styles := []string{}
+	added, removed := attrDiff(f.currentAttr, f.attr)
+	for _, a := range removed {
+		styles = append(styles, "no"+tmuxAttrs[a])
+	}
+	for _, a := range added {
+		styles = append(styles, tmuxAttrs[a])
+	}
+	if f.ulColor != f.currentUlColor {
+		styles = append(styles, "us="+tmuxColor(f.ulColor))
+	}
+	if f.color != f.currentColor {
+		styles = append(styles, "fg="+tmuxColor(f.color))
+	}
+	b.WriteString("#[" + strings.Join(styles, ",") + "]")
+	f.currentColor = f.color
+	f.currentAttr = f.attr
+	f.currentUlColor = f.ulColor
+}
+
+// tmuxColor returns the tmux name of a color.
+func tmuxColor(c color) string {
+	switch {
+	case c&colorKind == colorIndexed:
+		return "colour" + strconv.Itoa(int(uint8(c)))
+	case c&colorKind == colorRGB:
+		v := c.rgb()
+		return fmt.Sprintf("#%02x%02x%02x", v[0], v[1], v[2])
+	case c >= 30 && c <= 37:
+		return tmuxColors[c-30]
+	case c >= 90 && c <= 97:
+		return "bright" + tmuxColors[c-90]
+	}
+	return "default"
+}
@@ -1,13 +1,16 @@
 package gitprompt
 
 import (
-	"bufio"
 	"bytes"
-	"errors"
+	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 // GitStatus is the parsed status for the current state in git.
@@ -24,83 +27,522 @@ type GitStatus struct {
 	Upstream  string
 	Clean     bool
 	Outdated  bool
+	// Upstream is set but no longer exists on the remote.
+	UpstreamGone bool
+	// Unsafe is set if the repository is owned by someone else. Its status
+	// is only parsed in safe mode with ParseOptions.AllowUnsafe.
+	Unsafe bool
+	// Unborn is set if the current branch has no commits yet, e.g. in a new
+	// repository. Sha is empty but Branch is set.
+	Unborn bool
+	// GitDir is the absolute path to the repository's git directory, Root
+	// the top-level directory of the working tree and Prefix the current
+	// directory relative to Root.
+	GitDir string
+	Root   string
+	Prefix string
+	// Fetched is set if the repository has been fetched, FetchAge is the
+	// time since the last fetch.
+	Fetched  bool
+	FetchAge time.Duration
+	// Fetching is set while a background fetch is running, FetchFailed if
+	// the last background fetch failed.
+	Fetching    bool
+	FetchFailed bool
+	// Inserted and deleted lines in the working tree and the index, only
+	// parsed with the DiffStat detail.
+	Insertions       int
+	Deletions        int
+	StagedInsertions int
+	StagedDeletions  int
+	// Shallow is set for shallow clones. Partial clones, sparse checkouts
+	// and the number of sparse-checkout patterns are only parsed with the
+	// CloneInfo detail.
+	Shallow        bool
+	Partial        bool
+	Sparse         bool
+	SparseCone     bool
+	SparsePatterns int
+	// BranchStashed is the number of stashes created on the current branch,
+	// StashAge and StashMessage are the age and message of the newest stash.
+	BranchStashed int
+	StashAge      time.Duration
+	StashMessage  string
+	// SkipWorktree and AssumeUnchanged are the number of files hidden from
+	// the status with git update-index, only parsed with the Hidden detail.
+	// Files outside of a sparse checkout are skip-worktree too, in a sparse
+	// checkout only files present in the working tree are counted.
+	SkipWorktree    int
+	AssumeUnchanged int
+	// Conflicts by kind, as described in git-status(1).
+	BothModified  int
+	BothAdded     int
+	BothDeleted   int
+	AddedByUs     int
+	AddedByThem   int
+	DeletedByUs   int
+	DeletedByThem int
+	// Unfinished is the number of commits ahead of the upstream with a
+	// fixup!, squash!, amend! or WIP subject, only parsed with the
+	// Unfinished detail.
+	Unfinished int
+	// Remote is the URL of the current branch's remote, or origin, only
+	// parsed with the RemoteInfo detail.
+	Remote Remote
 }
 
-// Parse parses the status for the repository from git. Returns nil if the
-// current directory is not part of a git repository.
+// Details select optional data that is expensive to collect, so it is only
+// parsed when requested. FormatDetails returns the details a format uses.
+type Details uint
+
+const (
+	// DiffStat parses the number of inserted and deleted lines.
+	DiffStat Details = 1 << iota
+	// CloneInfo parses whether the repository is a partial clone and uses a
+	// sparse checkout.
+	CloneInfo
+	// Hidden parses the number of skip-worktree and assume-unchanged files.
+	Hidden
+	// Unfinished parses the number of unpushed autosquash and WIP commits.
+	Unfinished
+	// RemoteInfo parses the remote URL into its host, owner and repository.
+	RemoteInfo
+)
+
+// ParseOptions configure how the status is parsed.
+type ParseOptions struct {
+	// Trusted disables safe mode. By default git is prevented from running
+	// programs configured in the repository, see safe.go.
+	Trusted bool
+	// Details select optional data to parse.
+	Details Details
+	// AllowUnsafe parses repositories owned by someone else in safe mode,
+	// which git refuses by default. Without it ParseWith returns
+	// ErrUnsafeRepository for them.
+	AllowUnsafe bool
+}
+
+// Parse parses the status for the repository from git in safe mode. Returns
+// ErrNotRepository if the current directory is not part of a git repository,
+// see errors.go for other errors.
 func Parse() (*GitStatus, error) {
+	return ParseWith(ParseOptions{})
+}
+
+// ParseWith parses the status for the repository from git according to the
+// options.
+func ParseWith(o ParseOptions) (*GitStatus, error) {
+
+	status := &GitStatus{}
 
-	stat, err := runGitCommand("git", "status", "--branch", "--porcelain=2")
+	var config []string
+	dirs, err := runGitCommand("git", revParseDirs...)
+	if err == ErrUnsafeRepository && o.AllowUnsafe && !o.Trusted {
+		// Safe mode doesn't let git run anything from the repository, so
+		// the status of a repository owned by someone else can be shown.
+		status.Unsafe = true
+		config = []string{"-c", "safe.directory=*"}
+		dirs, err = runGit(config, revParseDirs...)
+	}
 	if err != nil {
-		if strings.HasPrefix(err.Error(), "fatal:") {
-			return nil, nil
-		}
 		return nil, err
 	}
+	paths := parseDirs(dirs, status)
+	// Submodules have their own config, which isn't made safe, so git
+	// mustn't look into them in safe mode.
+	var submodules []string
+	if !o.Trusted {
+		config = append(config, safeConfig(config, paths.config, filepath.Join(status.GitDir, "config.worktree"))...)
+		submodules = []string{"--ignore-submodules=all"}
+	}
 
-	status := &GitStatus{}
+	stat, err := runGit(config, append([]string{"status", "--branch", "--porcelain=2"}, submodules...)...)
+	if err != nil {
+		return nil, err
+	}
 
-	lines := strings.Split(stat, "\n")
-	for _, line := range lines {
+	parseFetch(status)
+	parseStatus(stat, status)
+
+	status.Clean = status.Conflicts == 0 &&
+		status.Staged == 0 &&
+		status.Modified == 0
+	status.Outdated = !status.Clean ||
+		status.Ahead != 0 ||
+		status.Behind != 0 ||
+		status.Untracked != 0 ||
+		status.UpstreamGone
+
+	if stashes, err := runGit(config, "log", "--no-show-signature", "--walk-reflogs", "--format=%gs%x1f%ct", "refs/stash"); err == nil {
+		parseStashes(stashes, status)
+	}
+
+	if o.Details&CloneInfo != 0 {
+		parseCloneInfo(config, paths, status)
+	}
+
+	if o.Details&Hidden != 0 {
+		sparse, _ := runGit(config, "config", "--type=bool", "core.sparseCheckout")
+		if files, err := runGit(config, "-C", status.Root, "ls-files", "-v", "-z"); err == nil {
+			parseHidden(files, status.Root, parseBool(sparse), status)
+		}
+	}
+
+	if o.Details&Unfinished != 0 && status.Ahead > 0 {
+		if subjects, err := runGit(config, "log", "--no-show-signature", "--format=%s", "@{upstream}..HEAD"); err == nil {
+			status.Unfinished = countUnfinished(subjects)
+		}
+	}
+
+	if o.Details&RemoteInfo != 0 {
+		parseRemote(config, status)
+	}
+
+	if o.Details&DiffStat != 0 {
+		if stat, err := runGit(config, append([]string{"diff", "--shortstat", "--no-ext-diff", "--no-textconv"}, submodules...)...); err == nil {
+			status.Insertions, status.Deletions = parseShortstat(stat)
+		}
+		if stat, err := runGit(config, append([]string{"diff", "--shortstat", "--no-ext-diff", "--no-textconv", "--cached"}, submodules...)...); err == nil {
+			status.StagedInsertions, status.StagedDeletions = parseShortstat(stat)
+		}
+	}
+
+	return status, nil
+
+}
+
+func parseStatus(stat string, s *GitStatus) {
+	for _, line := range strings.Split(stat, "\n") {
+		if line == "" {
+			continue
+		}
 		switch line[0] {
 		case '#':
-			parseHeader(line, status)
+			parseHeader(line, s)
 		case '?':
-			status.Untracked++
+			s.Untracked++
 		case 'u':
-			status.Conflicts++
+			s.Conflicts++
+			if len(line) >= 4 {
+				parseConflict(line[2:4], s)
+			}
 		case '1', '2':
+			if len(line) < 4 {
+				continue
+			}
 			if line[2] != '.' {
-				status.Staged++
+				s.Staged++
 			}
 			if line[3] != '.' {
-				status.Modified++
+				s.Modified++
 			}
 		}
 	}
+}
 
-	status.Clean = status.Conflicts == 0 &&
-		status.Staged == 0 &&
-		status.Modified == 0
-	status.Outdated = !status.Clean ||
-		status.Ahead != 0 ||
-		status.Behind != 0 ||
-		status.Untracked != 0
+// parseConflict counts the conflict by its XY code.
+func parseConflict(xy string, s *GitStatus) {
+	switch xy {
+	case "UU":
+		s.BothModified++
+	case "AA":
+		s.BothAdded++
+	case "DD":
+		s.BothDeleted++
+	case "AU":
+		s.AddedByUs++
+	case "UA":
+		s.AddedByThem++
+	case "DU":
+		s.DeletedByUs++
+	case "UD":
+		s.DeletedByThem++
+	}
+}
+
+func parseHeader(h string, s *GitStatus) {
+	fields := strings.SplitN(h, " ", 3)
+	if len(fields) < 3 {
+		return
+	}
+	value := fields[2]
+	switch fields[1] {
+	case "branch.oid":
+		if value == "(initial)" {
+			s.Unborn = true
+		} else {
+			s.Sha = value
+		}
+	case "branch.head":
+		if value != "(detached)" {
+			s.Branch = value
+		}
+	case "branch.upstream":
+		s.Upstream = value
+		// git omits branch.ab when the upstream ref does not exist.
+		s.UpstreamGone = true
+	case "branch.ab":
+		parts := strings.Fields(value)
+		if len(parts) != 2 {
+			return
+		}
+		s.UpstreamGone = false
+		s.Ahead, _ = strconv.Atoi(strings.TrimPrefix(parts[0], "+"))
+		s.Behind, _ = strconv.Atoi(strings.TrimPrefix(parts[1], "-"))
+	}
+}
 
-	if stashed, err := runGitCommand("git", "rev-list", "--walk-reflogs", "--count", "refs/stash"); err == nil {
-		if s, err := strconv.Atoi(stashed); err == nil {
-			status.Stashed = s
+// parseStashes parses the stash reflog, one "<subject>\x1f<unix time>" line
+// per stash, newest first.
+func parseStashes(stashes string, s *GitStatus) {
+	for i, line := range strings.Split(stashes, "\n") {
+		fields := strings.SplitN(line, "\x1f", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		// "WIP on <branch>: <sha> <subject>" or "On <branch>: <message>",
+		// branch names can't contain colons.
+		subject := fields[0]
+		branch, message := "", subject
+		for _, prefix := range []string{"WIP on ", "On "} {
+			colon := strings.Index(subject, ": ")
+			if strings.HasPrefix(subject, prefix) && colon > len(prefix) {
+				branch = subject[len(prefix):colon]
+				message = subject[colon+2:]
+				break
+			}
+		}
+		s.Stashed++
+		if branch == s.Branch && branch != "" {
+			s.BranchStashed++
+		}
+		if i == 0 {
+			s.StashMessage = message
+			if t, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+				s.StashAge = time.Since(time.Unix(t, 0))
+				if s.StashAge < 0 {
+					s.StashAge = 0
+				}
+			}
 		}
 	}
+}
 
-	return status, nil
+// parseHidden parses the output of git ls-files -v -z, where skip-worktree
+// files are tagged S and assume-unchanged files have a lowercase tag. In a
+// sparse checkout the files outside of it are skip-worktree too, so only the
+// ones in the working tree are counted there.
+func parseHidden(files, root string, sparse bool, s *GitStatus) {
+	for _, file := range strings.Split(files, "\x00") {
+		if len(file) < 3 {
+			continue
+		}
+		tag := file[0]
+		if tag >= 'a' && tag <= 'z' {
+			s.AssumeUnchanged++
+			tag -= 'a' - 'A'
+		}
+		if tag != 'S' {
+			continue
+		}
+		// Files outside of a sparse checkout aren't in the working tree.
+		if sparse {
+			if _, err := os.Lstat(filepath.Join(root, file[2:])); err != nil {
+				continue
+			}
+		}
+		s.SkipWorktree++
+	}
+}
 
+// countUnfinished counts the commit subjects, one per line, that git rebase
+// --autosquash would squash or that are marked as work in progress.
+func countUnfinished(subjects string) int {
+	n := 0
+	for _, subject := range strings.Split(subjects, "\n") {
+		if isUnfinished(subject) {
+			n++
+		}
+	}
+	return n
 }
 
-func parseHeader(h string, s *GitStatus) {
-	if strings.HasPrefix(h, "# branch.oid") {
-		hash := h[13:]
-		if hash != "(initial)" {
-			s.Sha = hash
+func isUnfinished(subject string) bool {
+	for _, prefix := range []string{"fixup! ", "squash! ", "amend! "} {
+		if strings.HasPrefix(subject, prefix) {
+			return true
 		}
-		return
 	}
-	if strings.HasPrefix(h, "# branch.head") {
-		branch := h[14:]
-		if branch != "(detached)" {
-			s.Branch = branch
+	// WIP, WIP: or [wip] but not e.g. "Wipe".
+	subject = strings.TrimPrefix(subject, "[")
+	if len(subject) < 3 || !strings.EqualFold(subject[:3], "wip") {
+		return false
+	}
+	if len(subject) == 3 {
+		return true
+	}
+	next, _ := utf8.DecodeRuneInString(subject[3:])
+	return !unicode.IsLetter(next) && !unicode.IsDigit(next)
+}
+
+// parseShortstat parses the number of inserted and deleted lines from the
+// output of git diff --shortstat, e.g.
+// "3 files changed, 10 insertions(+), 2 deletions(-)".
+func parseShortstat(stat string) (insertions, deletions int) {
+	for _, part := range strings.Split(stat, ",") {
+		fields := strings.Fields(part)
+		if len(fields) < 2 {
+			continue
+		}
+		n, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
 		}
+		switch {
+		case strings.HasPrefix(fields[1], "insertion"):
+			insertions = n
+		case strings.HasPrefix(fields[1], "deletion"):
+			deletions = n
+		}
+	}
+	return insertions, deletions
+}
+
+// revParseDirs is the git command for parseDirs.
+var revParseDirs = []string{
+	"rev-parse",
+	"--absolute-git-dir",
+	"--git-path", "config",
+	"--git-path", "info/sparse-checkout",
+	"--is-shallow-repository",
+	"--show-toplevel",
+	"--show-prefix",
+}
+
+// gitPaths are paths to files in the git directory.
+type gitPaths struct {
+	config         string
+	sparseCheckout string
+}
+
+// parseDirs parses the output of revParseDirs.
+func parseDirs(dirs string, s *GitStatus) gitPaths {
+	var paths gitPaths
+	lines := strings.Split(dirs, "\n")
+	for len(lines) < 7 {
+		// The prefix is empty in the top-level directory.
+		lines = append(lines, "")
+	}
+	s.GitDir = lines[0]
+	paths.config, _ = filepath.Abs(lines[1])
+	paths.sparseCheckout, _ = filepath.Abs(lines[2])
+	s.Shallow = parseBool(lines[3])
+	s.Root = lines[4]
+	s.Prefix = strings.TrimSuffix(lines[5], "/")
+	return paths
+}
+
+// parseCloneInfo parses whether the repository is a partial clone and uses a
+// sparse checkout.
+func parseCloneInfo(config []string, paths gitPaths, s *GitStatus) {
+	vars, err := runGit(config, "config", "--get-regexp", `^(extensions\.partialclone|remote\..*\.promisor|core\.sparsecheckout(cone)?)$`)
+	if err != nil {
+		// Exits with 1 if nothing matches.
 		return
 	}
-	if strings.HasPrefix(h, "# branch.upstream") {
-		s.Upstream = h[18:]
+	for _, line := range strings.Split(vars, "\n") {
+		fields := strings.SplitN(line, " ", 2)
+		name := fields[0]
+		// A variable without a value, not even an empty one, is true.
+		value := len(fields) == 1 || parseBool(fields[1])
+		switch {
+		case name == "extensions.partialclone":
+			s.Partial = true
+		case strings.HasSuffix(name, ".promisor"):
+			s.Partial = s.Partial || value
+		case name == "core.sparsecheckout":
+			s.Sparse = value
+		case name == "core.sparsecheckoutcone":
+			s.SparseCone = value
+		}
 	}
-	if strings.HasPrefix(h, "# branch.ab") {
-		parts := strings.Split(h, " ")
-		s.Ahead, _ = strconv.Atoi(strings.TrimPrefix(parts[2], "+"))
-		s.Behind, _ = strconv.Atoi(strings.TrimPrefix(parts[3], "-"))
+	if !s.Sparse {
 		return
 	}
+	if patterns, err := ioutil.ReadFile(paths.sparseCheckout); err == nil {
+		s.SparsePatterns = countSparsePatterns(string(patterns), s.SparseCone)
+	}
+}
+
+// parseBool parses a git boolean: true, yes, on or a non-zero number, in any
+// case. Anything else is false.
+func parseBool(value string) bool {
+	switch strings.ToLower(value) {
+	case "true", "yes", "on":
+		return true
+	}
+	n, err := strconv.Atoi(value)
+	return err == nil && n != 0
+}
+
+// countSparsePatterns counts the patterns in a sparse-checkout file. In cone
+// mode it counts the directories as listed by git sparse-checkout list, not
+// the patterns git generates for their parents.
+func countSparsePatterns(patterns string, cone bool) int {
+	lines := strings.Split(patterns, "\n")
+	excluded := map[string]bool{}
+	for _, line := range lines {
+		if cone && strings.HasPrefix(line, "!") {
+			// "!/dir/*/" excludes the subdirectories of a parent "/dir/".
+			excluded[strings.TrimSuffix(line[1:], "*/")] = true
+		}
+	}
+	n := 0
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if cone && (strings.HasPrefix(line, "!") || line == "/*" || excluded[line]) {
+			continue
+		}
+		n++
+	}
+	return n
+}
+
+func parseFetch(s *GitStatus) {
+	var fetched, failed time.Time
+	if info, err := os.Stat(filepath.Join(s.GitDir, fetchedFile)); err == nil {
+		fetched = info.ModTime()
+	}
+	if info, err := os.Stat(filepath.Join(s.GitDir, fetchResultFile)); err == nil && info.Size() > 0 {
+		failed = info.ModTime()
+	}
+	// FETCH_HEAD is also written by fetches outside of gitprompt. Failed
+	// fetches leave it empty or truncated, no newer than the failure.
+	if info, err := os.Stat(filepath.Join(s.GitDir, "FETCH_HEAD")); err == nil && info.Size() > 0 &&
+		info.ModTime().After(fetched) && info.ModTime().After(failed) {
+		fetched = info.ModTime()
+	}
+	if !fetched.IsZero() {
+		s.Fetched = true
+		s.FetchAge = time.Since(fetched)
+		if s.FetchAge < 0 {
+			s.FetchAge = 0
+		}
+	}
+	if info, err := os.Stat(filepath.Join(s.GitDir, fetchLockFile)); err == nil {
+		s.Fetching = time.Since(info.ModTime()) < fetchLockTimeout
+	}
+	// A failed fetch leaves its error behind, unless git was fetched
+	// successfully since.
+	s.FetchFailed = !failed.IsZero() && !failed.Before(fetched)
+}
+
+// runGit runs git with the config arguments, see safeConfig.
+func runGit(config []string, args ...string) (string, error) {
+	return runGitCommand("git", append(append([]string{}, config...), args...)...)
 }
 
 func runGitCommand(cmd string, args ...string) (string, error) {
@@ -109,16 +551,13 @@ func runGitCommand(cmd string, args ...string) (string, error) {
 	var stderr bytes.Buffer
 
 	command := exec.Command(cmd, args...)
-	command.Stdout = bufio.NewWriter(&stdout)
-	command.Stderr = bufio.NewWriter(&stderr)
+	command.Stdout = &stdout
+	command.Stderr = &stderr
 	command.Env = os.Environ()
 	command.Env = append(command.Env, "LC_ALL=C")
 
 	if err := command.Run(); err != nil {
-		if stderr.Len() > 0 {
-			return "", errors.New(stderr.String())
-		}
-		return "", err
+		return "", gitError(err, args, stderr.String())
 	}
 
 	return strings.TrimSpace(stdout.String()), nil
@@ -8,7 +8,9 @@ import (
 	"os"
 	"os/exec"
 	"path"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestParseValues(t *testing.T) {
@@ -31,6 +33,7 @@ func TestParseValues(t *testing.T) {
 				Untracked: 1,
 				Clean:     true,
 				Outdated:  true,
+				Unborn:    true,
 			},
 		},
 		{
@@ -44,6 +47,7 @@ func TestParseValues(t *testing.T) {
 				Staged:   1,
 				Clean:    false,
 				Outdated: true,
+				Unborn:   true,
 			},
 		},
 		{
@@ -94,10 +98,101 @@ func TestParseValues(t *testing.T) {
 			`,
 			expected: &GitStatus{
 				Conflicts: 1,
+				BothAdded: 1,
 				Clean:     false,
 				Outdated:  true,
 			},
 		},
+		{
+			name: "delete/modify conflict",
+			setup: `
+				git init --initial-branch=master || git init
+				echo foo >> test
+				git add test
+				git commit -m 'initial'
+				git checkout -b other
+				git rm test
+				git commit -m 'delete'
+				git checkout master
+				echo bar >> test
+				git commit -am 'modify'
+				git merge other || true
+			`,
+			expected: &GitStatus{
+				Conflicts:     1,
+				DeletedByThem: 1,
+				Clean:         false,
+				Outdated:      true,
+			},
+		},
+		{
+			name: "modify/modify conflict",
+			setup: `
+				git init --initial-branch=master || git init
+				echo foo >> test
+				git add test
+				git commit -m 'initial'
+				git checkout -b other
+				echo bar >> test
+				git commit -am 'bar'
+				git checkout master
+				echo baz >> test
+				git commit -am 'baz'
+				git merge other || true
+			`,
+			expected: &GitStatus{
+				Conflicts:    1,
+				BothModified: 1,
+				Clean:        false,
+				Outdated:     true,
+			},
+		},
+		{
+			name: "modify/delete conflict",
+			setup: `
+				git init --initial-branch=master || git init
+				echo foo >> test
+				git add test
+				git commit -m 'initial'
+				git checkout -b other
+				echo bar >> test
+				git commit -am 'modify'
+				git checkout master
+				git rm test
+				git commit -m 'delete'
+				git merge other || true
+			`,
+			expected: &GitStatus{
+				Conflicts:   1,
+				DeletedByUs: 1,
+				Clean:       false,
+				Outdated:    true,
+			},
+		},
+		{
+			name: "rename/rename conflict",
+			setup: `
+				git init --initial-branch=master || git init
+				echo foo >> test
+				git add test
+				git commit -m 'initial'
+				git checkout -b other
+				git mv test theirs
+				git commit -m 'theirs'
+				git checkout master
+				git mv test ours
+				git commit -m 'ours'
+				git merge other || true
+			`,
+			expected: &GitStatus{
+				Conflicts:   3,
+				BothDeleted: 1,
+				AddedByUs:   1,
+				AddedByThem: 1,
+				Clean:       false,
+				Outdated:    true,
+			},
+		},
 		{
 			name: "ahead",
 			setup: `
@@ -131,6 +226,23 @@ func TestParseValues(t *testing.T) {
 				Outdated: true,
 			},
 		},
+		{
+			name: "upstream gone",
+			setup: `
+				git init --initial-branch=master || git init
+				git remote add origin $REMOTE
+				git commit --allow-empty -m 'first'
+				git checkout -b feature
+				git push -u origin HEAD
+				git push origin --delete feature
+			`,
+			expected: &GitStatus{
+				Upstream:     "origin/feature",
+				UpstreamGone: true,
+				Clean:        true,
+				Outdated:     true,
+			},
+		},
 		{
 			name: "stashed",
 			setup: `
@@ -162,26 +274,38 @@ func TestParseValues(t *testing.T) {
 			}
 
 			actual, err := Parse()
-			if err != nil {
-				t.Errorf("Received unexpected error: %v", err)
-				return
-			}
 			if test.expected == nil {
+				if err != ErrNotRepository {
+					t.Errorf("Expected ErrNotRepository, got %v", err)
+				}
 				if actual != nil {
 					t.Errorf("Expected nil return, got %v", actual)
 				}
 				return
 			}
+			if err != nil {
+				t.Errorf("Received unexpected error: %v", err)
+				return
+			}
 			assertInt(t, "Untracked", test.expected.Untracked, actual.Untracked)
 			assertInt(t, "Modified", test.expected.Modified, actual.Modified)
 			assertInt(t, "Staged", test.expected.Staged, actual.Staged)
 			assertInt(t, "Conflicts", test.expected.Conflicts, actual.Conflicts)
+			assertInt(t, "BothModified", test.expected.BothModified, actual.BothModified)
+			assertInt(t, "BothAdded", test.expected.BothAdded, actual.BothAdded)
+			assertInt(t, "BothDeleted", test.expected.BothDeleted, actual.BothDeleted)
+			assertInt(t, "AddedByUs", test.expected.AddedByUs, actual.AddedByUs)
+			assertInt(t, "AddedByThem", test.expected.AddedByThem, actual.AddedByThem)
+			assertInt(t, "DeletedByUs", test.expected.DeletedByUs, actual.DeletedByUs)
+			assertInt(t, "DeletedByThem", test.expected.DeletedByThem, actual.DeletedByThem)
 			assertInt(t, "Ahead", test.expected.Ahead, actual.Ahead)
 			assertInt(t, "Behind", test.expected.Behind, actual.Behind)
 			assertInt(t, "Stashed", test.expected.Stashed, actual.Stashed)
 			assertString(t, "Upstream", test.expected.Upstream, actual.Upstream)
 			assertBool(t, "Clean", test.expected.Clean, actual.Clean)
 			assertBool(t, "Outdated", test.expected.Outdated, actual.Outdated)
+			assertBool(t, "UpstreamGone", test.expected.UpstreamGone, actual.UpstreamGone)
+			assertBool(t, "Unborn", test.expected.Unborn, actual.Unborn)
 		})
 	}
 }
@@ -195,12 +319,15 @@ func TestParseHead(t *testing.T) {
 	`)
 	s, _ := Parse()
 	assertString(t, "branch", "master", s.Branch)
+	assertString(t, "sha", "", s.Sha)
+	assertBool(t, "unborn", true, s.Unborn)
 
 	setupCommands(t, dir, `
 		git commit --allow-empty -m 'initial'
 	`)
 	s, _ = Parse()
 	assertString(t, "branch", "master", s.Branch)
+	assertBool(t, "unborn", false, s.Unborn)
 
 	setupCommands(t, dir, `
 		git checkout -b other
@@ -208,6 +335,13 @@ func TestParseHead(t *testing.T) {
 	s, _ = Parse()
 	assertString(t, "branch", "other", s.Branch)
 
+	setupCommands(t, dir, `
+		git checkout -b 'fix!$(id)'
+	`)
+	s, _ = Parse()
+	assertString(t, "branch", "fix!$(id)", s.Branch)
+	assertString(t, "bash", "fix\\041\\$(id)", PrintWith(s, "%h", PrintOptions{Shell: ShellBash}))
+
 	setupCommands(t, dir, `
 		git commit --allow-empty -m 'second'
 		git checkout HEAD^
@@ -219,14 +353,417 @@ func TestParseHead(t *testing.T) {
 	}
 }
 
+func TestParseStatusEdgeCases(t *testing.T) {
+	tests := []struct {
+		name     string
+		stat     string
+		expected GitStatus
+	}{
+		{name: "empty", stat: ""},
+		{name: "blank lines", stat: "\n\n"},
+		{name: "bare header", stat: "#\n# \n# branch.oid"},
+		{name: "truncated ab", stat: "# branch.ab\n# branch.ab +1"},
+		{name: "truncated entries", stat: "1\n1 M\n2 ."},
+		{name: "unknown lines", stat: "! ignored\nx\n# stash 3"},
+		{
+			name:     "initial",
+			stat:     "# branch.oid (initial)\n# branch.head master",
+			expected: GitStatus{Branch: "master", Unborn: true},
+		},
+		{
+			name:     "detached",
+			stat:     "# branch.oid 0455b83\n# branch.head (detached)",
+			expected: GitStatus{Sha: "0455b83"},
+		},
+		{
+			name:     "short paths",
+			stat:     "? a\n1 .M N... 100644 100644 100644 0 0 b",
+			expected: GitStatus{Untracked: 1, Modified: 1},
+		},
+		{
+			name: "conflict kinds",
+			stat: "u UU N... 1\nu UU N... 2\nu AA N...\nu DD\nu AU\nu UA\nu DU\nu UD\nu ??\nu",
+			expected: GitStatus{
+				Conflicts:     10,
+				BothModified:  2,
+				BothAdded:     1,
+				BothDeleted:   1,
+				AddedByUs:     1,
+				AddedByThem:   1,
+				DeletedByUs:   1,
+				DeletedByThem: 1,
+			},
+		},
+		{
+			name:     "branch with spaces in upstream line",
+			stat:     "# branch.upstream origin/a b\n# branch.ab +0 -0",
+			expected: GitStatus{Upstream: "origin/a b"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var actual GitStatus
+			parseStatus(test.stat, &actual)
+			if actual != test.expected {
+				t.Errorf("Expected %+v, got %+v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestParseDiffStat(t *testing.T) {
+	dir, done := setupTestDir(t)
+	defer done()
+
+	setupCommands(t, dir, `
+		git init --initial-branch=master || git init
+		printf 'a\nb\nc\n' > test
+		git add test
+		git commit -m 'initial'
+		printf 'a\nB\nc\nd\n' > test
+		git add test
+		printf 'a\nc\nd\ne\nf\n' > test
+	`)
+
+	s, _ := Parse()
+	assertInt(t, "Insertions", 0, s.Insertions)
+	assertInt(t, "StagedInsertions", 0, s.StagedInsertions)
+
+	s, _ = ParseWith(ParseOptions{Details: DiffStat})
+	assertInt(t, "Insertions", 2, s.Insertions)
+	assertInt(t, "Deletions", 1, s.Deletions)
+	assertInt(t, "StagedInsertions", 2, s.StagedInsertions)
+	assertInt(t, "StagedDeletions", 1, s.StagedDeletions)
+}
+
+func TestParseShortstat(t *testing.T) {
+	tests := map[string][2]int{
+		"":                                {0, 0},
+		" 1 file changed, 1 insertion(+)": {1, 0},
+		" 1 file changed, 2 deletions(-)": {0, 2},
+		" 3 files changed, 10 insertions(+), 2 deletions(-)": {10, 2},
+	}
+	for stat, expected := range tests {
+		insertions, deletions := parseShortstat(stat)
+		assertInt(t, stat+" insertions", expected[0], insertions)
+		assertInt(t, stat+" deletions", expected[1], deletions)
+	}
+}
+
+func TestParseUnfinished(t *testing.T) {
+	dir, done := setupTestDir(t)
+	defer done()
+	remote, cleanupRemote := setupRemote(t, dir)
+	defer cleanupRemote()
+
+	setupCommands(t, dir, `
+		git init --initial-branch=master || git init
+		git remote add origin `+remote+`
+		git commit --allow-empty -m 'WIP: pushed'
+		git push -u origin HEAD
+		git commit --allow-empty -m 'Add feature'
+		git commit --allow-empty -m 'fixup! Add feature'
+		git commit --allow-empty -m 'WIP'
+	`)
+
+	s, _ := Parse()
+	assertInt(t, "Unfinished", 0, s.Unfinished)
+
+	s, _ = ParseWith(ParseOptions{Details: Unfinished})
+	assertInt(t, "Unfinished", 2, s.Unfinished)
+}
+
+func TestCountUnfinished(t *testing.T) {
+	tests := map[string]int{
+		"":                             0,
+		"Add feature":                  0,
+		"fixup! Add feature":           1,
+		"squash! Add feature":          1,
+		"amend! Add feature":           1,
+		"fixup!":                       0,
+		"WIP":                          1,
+		"wip: tests":                   1,
+		"[WIP] tests":                  1,
+		"Wipe cache":                   0,
+		"Fix WIP commits":              0,
+		"WIP\nfixup! a\nAdd feature\n": 2,
+	}
+	for subjects, expected := range tests {
+		assertInt(t, subjects, expected, countUnfinished(subjects))
+	}
+}
+
+func TestParseCloneInfo(t *testing.T) {
+	dir, done := setupTestDir(t)
+	defer done()
+	remote, cleanupRemote := setupRemote(t, dir)
+	defer cleanupRemote()
+
+	setupCommands(t, dir, `
+		git init --initial-branch=master || git init
+		git remote add origin `+remote+`
+		mkdir a b c
+		touch a/x b/x c/x
+		git add .
+		git commit -m 'first'
+		git commit --allow-empty -m 'second'
+		git push -u origin HEAD
+		git -C `+remote+` config uploadpack.allowFilter true
+		git clone --depth 1 file://`+remote+` shallow
+		git clone --filter=blob:none file://`+remote+` partial
+		git -C partial sparse-checkout set a b
+	`)
+
+	s, _ := ParseWith(ParseOptions{Details: CloneInfo})
+	assertBool(t, "Shallow", false, s.Shallow)
+	assertBool(t, "Partial", false, s.Partial)
+	assertBool(t, "Sparse", false, s.Sparse)
+
+	if err := os.Chdir(path.Join(dir, "shallow")); err != nil {
+		t.Fatal(err)
+	}
+	s, _ = Parse()
+	assertBool(t, "Shallow", true, s.Shallow)
+
+	if err := os.Chdir(path.Join(dir, "partial", "a")); err != nil {
+		t.Fatal(err)
+	}
+	s, _ = Parse()
+	assertBool(t, "Partial", false, s.Partial)
+	assertBool(t, "Sparse", false, s.Sparse)
+	s, _ = ParseWith(ParseOptions{Details: CloneInfo})
+	assertBool(t, "Shallow", false, s.Shallow)
+	assertBool(t, "Partial", true, s.Partial)
+	assertBool(t, "Sparse", true, s.Sparse)
+	assertBool(t, "SparseCone", true, s.SparseCone)
+	assertInt(t, "SparsePatterns", 2, s.SparsePatterns)
+
+	// Any git boolean works, a variable without a value is true.
+	setupCommands(t, dir, `
+		printf '[core]\n\tsparseCheckout = Yes\n\tsparseCheckoutCone\n' > partial/.git/config.worktree
+	`)
+	s, _ = ParseWith(ParseOptions{Details: CloneInfo})
+	assertBool(t, "Sparse", true, s.Sparse)
+	assertBool(t, "SparseCone", true, s.SparseCone)
+	setupCommands(t, dir, `
+		git -C partial config --worktree core.sparseCheckout off
+	`)
+	s, _ = ParseWith(ParseOptions{Details: CloneInfo})
+	assertBool(t, "Sparse", false, s.Sparse)
+}
+
+func TestParseBool(t *testing.T) {
+	tests := map[string]bool{
+		"true": true, "Yes": true, "ON": true, "1": true, "-2": true,
+		"false": false, "no": false, "off": false, "0": false, "": false, "maybe": false,
+	}
+	for value, expected := range tests {
+		assertBool(t, value, expected, parseBool(value))
+	}
+}
+
+func TestCountSparsePatterns(t *testing.T) {
+	tests := []struct {
+		patterns string
+		cone     bool
+		expected int
+	}{
+		{"", false, 0},
+		{"# comment\n\n/docs/\n*.md\n!/docs/internal/\n", false, 3},
+		{"/*\n!/*/\n", true, 0},
+		{"/*\n!/*/\n/a/\n!/a/*/\n/a/b/\n/c/\n", true, 2},
+	}
+	for _, test := range tests {
+		assertInt(t, fmt.Sprintf("%q", test.patterns), test.expected, countSparsePatterns(test.patterns, test.cone))
+	}
+}
+
+func TestParseStashDetails(t *testing.T) {
+	dir, done := setupTestDir(t)
+	defer done()
+
+	setupCommands(t, dir, `
+		git init --initial-branch=master || git init
+		echo "hello" >> test
+		git add test
+		git commit -m 'initial'
+		echo "world" >> test
+		git stash
+		git checkout -b other
+		echo "other" >> test
+		git stash
+		git checkout master
+		echo "again" >> test
+		git stash push -m 'work: in progress'
+	`)
+
+	s, _ := Parse()
+	assertInt(t, "Stashed", 3, s.Stashed)
+	assertInt(t, "BranchStashed", 2, s.BranchStashed)
+	assertString(t, "StashMessage", "work: in progress", s.StashMessage)
+	if s.StashAge < 0 || s.StashAge > time.Minute {
+		t.Errorf("Expected recent stash, got %v", s.StashAge)
+	}
+}
+
+func TestParseStashes(t *testing.T) {
+	var s GitStatus
+	s.Branch = "feature"
+	parseStashes(strings.Join([]string{
+		"WIP on feature: 0455b83 add thing\x1f0",
+		"On master: fix: later\x1f0",
+		"WIP on (no branch): 0455b83 detached\x1f0",
+		"On feature: \x1f0",
+		"garbage",
+		"custom subject\x1f0",
+	}, "\n"), &s)
+	assertInt(t, "Stashed", 5, s.Stashed)
+	assertInt(t, "BranchStashed", 2, s.BranchStashed)
+	assertString(t, "StashMessage", "0455b83 add thing", s.StashMessage)
+}
+
+func TestParseHidden(t *testing.T) {
+	dir, done := setupTestDir(t)
+	defer done()
+
+	setupCommands(t, dir, `
+		git init --initial-branch=master || git init
+		mkdir sub
+		touch config.local other sub/assumed sub/both
+		git add .
+		git commit -m 'initial'
+		git update-index --skip-worktree config.local
+		git update-index --assume-unchanged sub/assumed
+		git update-index --skip-worktree sub/both
+		git update-index --assume-unchanged sub/both
+	`)
+
+	s, _ := Parse()
+	assertInt(t, "SkipWorktree", 0, s.SkipWorktree)
+	assertInt(t, "AssumeUnchanged", 0, s.AssumeUnchanged)
+
+	if err := os.Chdir(path.Join(dir, "sub")); err != nil {
+		t.Fatal(err)
+	}
+	s, _ = ParseWith(ParseOptions{Details: Hidden})
+	assertInt(t, "SkipWorktree", 2, s.SkipWorktree)
+	assertInt(t, "AssumeUnchanged", 2, s.AssumeUnchanged)
+
+	// Files outside of a sparse checkout are skip-worktree too.
+	setupCommands(t, dir, `
+		git sparse-checkout set --no-cone /sub/
+	`)
+	s, _ = ParseWith(ParseOptions{Details: Hidden})
+	assertInt(t, "SkipWorktree", 0, s.SkipWorktree)
+	assertInt(t, "AssumeUnchanged", 2, s.AssumeUnchanged)
+
+	// Files marked skip-worktree inside of it are still counted. Without
+	// sparse.expectFilesOutsideOfPatterns git clears their flag.
+	setupCommands(t, dir, `
+		git config sparse.expectFilesOutsideOfPatterns true
+		git update-index --skip-worktree sub/both
+	`)
+	s, _ = ParseWith(ParseOptions{Details: Hidden})
+	assertInt(t, "SkipWorktree", 1, s.SkipWorktree)
+	assertInt(t, "AssumeUnchanged", 2, s.AssumeUnchanged)
+}
+
+func TestParseDirs(t *testing.T) {
+	dir, done := setupTestDir(t)
+	defer done()
+
+	setupCommands(t, dir, `
+		git init --initial-branch=master || git init
+		mkdir -p sub/dir
+	`)
+	s, _ := Parse()
+	assertString(t, "Root", path.Base(dir), path.Base(s.Root))
+	assertString(t, "Prefix", "", s.Prefix)
+
+	if err := os.Chdir(path.Join(dir, "sub", "dir")); err != nil {
+		t.Fatal(err)
+	}
+	s, _ = Parse()
+	assertString(t, "Root", path.Base(dir), path.Base(s.Root))
+	assertString(t, "Prefix", "sub/dir", s.Prefix)
+}
+
+func TestParseFetch(t *testing.T) {
+	dir, done := setupTestDir(t)
+	defer done()
+	remote, cleanupRemote := setupRemote(t, dir)
+	defer cleanupRemote()
+
+	setupCommands(t, dir, `
+		git init --initial-branch=master || git init
+		git remote add origin `+remote+`
+		git commit --allow-empty -m 'initial'
+		git push -u origin HEAD
+	`)
+	s, _ := Parse()
+	assertBool(t, "Fetched", false, s.Fetched)
+	if s.GitDir == "" {
+		t.Errorf("Expected GitDir to be set")
+	}
+
+	setupCommands(t, dir, `
+		git fetch
+	`)
+	s, _ = Parse()
+	assertBool(t, "Fetched", true, s.Fetched)
+	if s.FetchAge < 0 || s.FetchAge > time.Minute {
+		t.Errorf("Expected recent fetch, got %v", s.FetchAge)
+	}
+}
+
 func TestExecGitErr(t *testing.T) {
 	path := os.Getenv("PATH")
 	os.Setenv("PATH", "")
 	defer os.Setenv("PATH", path)
 
 	_, err := Parse()
-	if err == nil {
-		t.Errorf("Expected error when git not found on $PATH")
+	if err != ErrGitNotFound {
+		t.Errorf("Expected ErrGitNotFound when git not found on $PATH, got %v", err)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	dir, done := setupTestDir(t)
+	defer done()
+
+	setupCommands(t, dir, `
+		git init --initial-branch=master || git init
+		git commit --allow-empty -m 'initial'
+	`)
+
+	if err := os.Chdir(path.Join(dir, ".git")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Parse(); err != ErrNotRepository {
+		t.Errorf("Expected ErrNotRepository in git dir, got %v", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("GIT_TEST_ASSUME_DIFFERENT_OWNER", "1")
+	_, err := ParseWith(ParseOptions{Trusted: true})
+	os.Unsetenv("GIT_TEST_ASSUME_DIFFERENT_OWNER")
+	if err != ErrUnsafeRepository {
+		t.Errorf("Expected ErrUnsafeRepository, got %v", err)
+	}
+
+	setupCommands(t, dir, `
+		echo corrupt > .git/index
+	`)
+	_, err = Parse()
+	gitErr, ok := err.(*GitError)
+	if !ok {
+		t.Fatalf("Expected *GitError, got %T: %v", err, err)
+	}
+	assertInt(t, "ExitCode", 128, gitErr.ExitCode)
+	if !strings.Contains(gitErr.Stderr, "index") {
+		t.Errorf("Expected stderr to mention the index, got %q", gitErr.Stderr)
 	}
 }
 
@@ -6,8 +6,10 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 	"unicode"
 )
 
@@ -17,24 +19,39 @@ const (
 	tReset     rune = '_'
 	tLeak      rune = '>'
 	tData      rune = '%'
+	tLink      rune = '&'
 	tGroupOp   rune = '['
 	tGroupCl   rune = ']'
 	tEsc       rune = '\\'
+	tExtOp     rune = '{'
+	tExtCl     rune = '}'
 )
 
 var attrs = map[rune]uint8{
-	'b': 1, // bold
-	'f': 2, // faint
-	'i': 3, // italic
+	'b': attrBold,
+	'f': attrFaint,
+	'i': attrItalic,
+	'u': attrUnderline,
+	'd': attrDoubleUnderline,
+	'c': attrCurlyUnderline,
+	'k': attrBlink,
+	'r': attrReverse,
+	's': attrStrike,
+	'o': attrOverline,
 }
 
 var resetAttrs = map[rune]uint8{
-	'B': 1, // bold
-	'F': 2, // faint
-	'I': 3, // italic
+	'B': attrBold,
+	'F': attrFaint,
+	'I': attrItalic,
+	'U': attrUnderline, // all underline styles and the underline color
+	'K': attrBlink,
+	'R': attrReverse,
+	'S': attrStrike,
+	'O': attrOverline,
 }
 
-var colors = map[rune]uint8{
+var colors = map[rune]color{
 	'k': 30, // black
 	'r': 31, // red
 	'g': 32, // green
@@ -64,15 +81,78 @@ const (
 	behind    rune = 'b'
 	stashed   rune = 'S'
 	upstream  rune = 'U'
+	fetchAge  rune = 'f'
+	repoName  rune = 'r'
+	repoPath  rune = 'p'
+	inserted  rune = 'i'
+	deleted   rune = 'd'
+	sInserted rune = 'j'
+	sDeleted  rune = 'k'
+	sparsePat rune = 'T'
+	bStashed  rune = 'B'
+	stashAge  rune = 'A'
+	stashMsg  rune = 'M'
+	skipWt    rune = 'w'
+	assumeUn  rune = 'q'
+	cModified rune = 'x'
+	cAdded    rune = 'n'
+	cDeleted  rune = 'v'
+	cOther    rune = 'R'
+	unfinCnt  rune = 'Q'
+	rHost     rune = 'E'
+	rOwner    rune = 'J'
+	rRepo     rune = 'V'
+	rWeb      rune = 'Z'
+	forge     rune = 'G'
 	// enablers without data
-	clean    rune = 'C'
-	dirty    rune = 'D'
-	outdated rune = 'O'
-	latest   rune = 'L'
-	local    rune = 'l'
-	if_else  rune = 'e'
+	clean     rune = 'C'
+	dirty     rune = 'D'
+	outdated  rune = 'O'
+	latest    rune = 'L'
+	local     rune = 'l'
+	unborn    rune = 'N'
+	unsafe    rune = 'o'
+	gone      rune = 'g'
+	stale     rune = 'F'
+	fetching  rune = 'P'
+	failed    rune = 'X'
+	largeDiff rune = 'z'
+	shallow   rune = 'y'
+	partial   rune = 'Y'
+	sparse    rune = 't'
+	hidden    rune = 'W'
+	unfin     rune = 'K'
+	if_else   rune = 'e'
 )
 
+const (
+	linkRepo   rune = 'r'
+	linkBranch rune = 'b'
+	linkCommit rune = 'c'
+)
+
+// tokenDetails are the details needed by data tokens.
+var tokenDetails = map[rune]Details{
+	inserted:  DiffStat,
+	deleted:   DiffStat,
+	sInserted: DiffStat,
+	sDeleted:  DiffStat,
+	largeDiff: DiffStat,
+	partial:   CloneInfo,
+	sparse:    CloneInfo,
+	sparsePat: CloneInfo,
+	skipWt:    Hidden,
+	assumeUn:  Hidden,
+	hidden:    Hidden,
+	unfinCnt:  Unfinished,
+	unfin:     Unfinished,
+	rHost:     RemoteInfo,
+	rOwner:    RemoteInfo,
+	rRepo:     RemoteInfo,
+	rWeb:      RemoteInfo,
+	forge:     RemoteInfo,
+}
+
 type group struct {
 	buf bytes.Buffer
 
@@ -86,11 +166,82 @@ type group struct {
 	leakColor  bool
 	leakAttr   bool
 	width      int
+	// link is the OSC 8 sequence that started the current hyperlink.
+	link string
+}
+
+const (
+	// DefaultStaleFetch is the age after which the last fetch is considered
+	// stale if PrintOptions.StaleFetch is not set.
+	DefaultStaleFetch = time.Hour
+	// DefaultLargeDiff is the number of changed lines above which a diff is
+	// considered large if PrintOptions.LargeDiff is not set.
+	DefaultLargeDiff = 500
+)
+
+// PrintOptions configure how the status is printed.
+type PrintOptions struct {
+	// Shell is the shell the output is embedded in, data values are escaped
+	// for it. ShellZsh also adds zsh width control characters.
+	Shell Shell
+	// StaleFetch is the age after which the last fetch is considered stale.
+	StaleFetch time.Duration
+	// PathSegments is the number of trailing segments of the path within
+	// the repository that are printed in full, all if zero. Leading segments
+	// are abbreviated to their first letter if PathAbbrev is set, or else
+	// replaced by a single "…".
+	PathSegments int
+	PathAbbrev   bool
+	// LargeDiff is the number of inserted and deleted lines, staged or not,
+	// above which the diff is considered large.
+	LargeDiff int
+	// Theme resolves the palette slots used as #{name}, DefaultTheme if nil.
+	Theme Theme
+	// Colors is the range of colors the terminal supports, colors in the
+	// format are mapped to the nearest supported color.
+	Colors ColorSupport
+	// NoReset never resets all colors and attributes at once (SGR 0), only
+	// those that were set. Use it to embed the output in a prompt with its
+	// own colors.
+	NoReset bool
+	// Output is the markup for colors and attributes. Links are only
+	// printed for OutputANSI.
+	Output Output
+	// Forges map hosts to the labels printed by %G, DefaultForges if nil.
+	Forges map[string]string
+	// BranchRewrites are applied in order to the branch printed by %h and
+	// %H, before it's truncated.
+	BranchRewrites []BranchRewrite
 }
 
 // Print prints the status according to the format.
 func Print(s *GitStatus, format string, zsh bool) string {
+	o := PrintOptions{}
+	if zsh {
+		o.Shell = ShellZsh
+	}
+	return PrintWith(s, format, o)
+}
 
+// PrintWith prints the status according to the format and options.
+func PrintWith(s *GitStatus, format string, o PrintOptions) string {
+	return buildOutput(s, readRunes(format), withDefaults(o))
+}
+
+// PrintTitle prints the status according to the format as an OSC 2 sequence
+// that sets the terminal's window title. Colors, attributes and links are
+// left out, data is still escaped for the shell.
+func PrintTitle(s *GitStatus, format string, o PrintOptions) string {
+	o.Output = OutputPlain
+	title := "\x1b]2;" + buildOutput(s, readRunes(format), withDefaults(o)) + "\a"
+	if o.Shell == ShellZsh {
+		// The sequence has no width.
+		return "%{" + title + "%}"
+	}
+	return title
+}
+
+func readRunes(format string) chan rune {
 	in := make(chan rune)
 	go func() {
 		r := bufio.NewReader(strings.NewReader(format))
@@ -103,22 +254,81 @@ func Print(s *GitStatus, format string, zsh bool) string {
 			in <- ch
 		}
 	}()
+	return in
+}
 
-	return buildOutput(s, in, zsh)
+func withDefaults(o PrintOptions) *PrintOptions {
+	if o.StaleFetch == 0 {
+		o.StaleFetch = DefaultStaleFetch
+	}
+	if o.LargeDiff == 0 {
+		o.LargeDiff = DefaultLargeDiff
+	}
+	return &o
+}
 
+// FormatDetails returns the details needed to print the format, to be passed
+// to ParseWith.
+func FormatDetails(format string) Details {
+	var details Details
+	var prefix rune
+	// ext is the prefix of an unfinished #{name}, @{name} or %{name}. Only
+	// the names of long data tokens need details.
+	var ext rune
+	var name strings.Builder
+	for _, ch := range format {
+		if ext != 0 {
+			if ch != tExtCl {
+				name.WriteRune(ch)
+				continue
+			}
+			if ch, _, ok := parseLongToken(name.String()); ok && ext == tData {
+				details |= tokenDetails[ch]
+			}
+			ext = 0
+			name.Reset()
+			continue
+		}
+		if prefix != 0 {
+			if ch == tExtOp && (prefix == tData || prefix == tColor || prefix == tAttribute) {
+				ext = prefix
+			} else if prefix == tData {
+				details |= tokenDetails[ch]
+			}
+			if prefix == tLink && ch != tReset {
+				details |= RemoteInfo
+			}
+			prefix = 0
+			continue
+		}
+		switch ch {
+		case tEsc, tColor, tAttribute, tData, tLink:
+			prefix = ch
+		}
+	}
+	return details
 }
 
-func buildOutput(s *GitStatus, in chan rune, zsh bool) string {
+func buildOutput(s *GitStatus, in chan rune, o *PrintOptions) string {
 
 	root := &group{}
+	root.format.output = o.Output
+	root.format.noReset = o.NoReset
 	g := root
 
 	col := false
+	// ext is the prefix of an unfinished #{name}, @{name} or %{name}.
+	var ext rune
+	var name strings.Builder
 	att := false
 	dat := false
+	lnk := false
 	esc := false
 	last := true
 
+	// Only ANSI markup is excluded from the width. Plain output has none and
+	// tmux would print the zsh sequences as they are.
+	zsh := o.Shell == ShellZsh && o.Output == OutputANSI
 	if zsh {
 		root.buf.WriteString("%{")
 	}
@@ -130,21 +340,59 @@ func buildOutput(s *GitStatus, in chan rune, zsh bool) string {
 			continue
 		}
 
+		if ext != 0 {
+			if ch == tExtCl && ext == tData {
+				if !setLongData(g, s, o, last, name.String()) {
+					g.addString(string(tData) + string(tExtOp) + name.String() + string(tExtCl))
+				}
+				ext = 0
+				name.Reset()
+			} else if ch == tExtCl {
+				setExtendedColor(g, o, ext, name.String())
+				ext = 0
+				name.Reset()
+			} else {
+				name.WriteRune(ch)
+			}
+			continue
+		}
+
 		if col {
-			setColor(g, ch)
 			col = false
+			if ch == tExtOp {
+				ext = tColor
+				continue
+			}
+			setColor(g, o, ch)
 			continue
 		}
 
 		if att {
-			setAttribute(g, ch)
 			att = false
+			if ch == tExtOp {
+				ext = tAttribute
+				continue
+			}
+			setAttribute(g, ch)
 			continue
 		}
 
 		if dat {
-			setData(g, s, last, ch)
 			dat = false
+			if ch == tExtOp {
+				ext = tData
+				continue
+			}
+			if !setData(g, s, o, last, ch, nil) {
+				g.addRune(tData)
+				g.addRune(ch)
+			}
+			continue
+		}
+
+		if lnk {
+			setLink(g, s, o, ch)
+			lnk = false
 			continue
 		}
 
@@ -157,10 +405,13 @@ func buildOutput(s *GitStatus, in chan rune, zsh bool) string {
 			att = true
 		case tData:
 			dat = true
+		case tLink:
+			lnk = true
 		case tGroupOp:
 			g = &group{
 				parent: g,
 				format: g.format,
+				link:   g.link,
 			}
 			g.format.clearAttributes()
 			g.format.clearColor()
@@ -174,6 +425,14 @@ func buildOutput(s *GitStatus, in chan rune, zsh bool) string {
 				g.hasData = true
 				g.hasValue = g.wasEnabled
 			}
+			if g.link != g.parent.link {
+				// Links are scoped to the group, restore the parent's.
+				if g.parent.link != "" {
+					g.buf.WriteString(g.parent.link)
+				} else {
+					g.endLink()
+				}
+			}
 			last = g.writeTo(&g.parent.buf)
 			if last {
 				g.parent.format = g.format
@@ -201,12 +460,19 @@ func buildOutput(s *GitStatus, in chan rune, zsh bool) string {
 	if col {
 		g.addRune(tColor)
 	}
+	if ext != 0 {
+		g.addString(string(ext) + string(tExtOp) + name.String())
+	}
 	if att {
 		g.addRune(tAttribute)
 	}
 	if dat {
 		g.addRune(tData)
 	}
+	if lnk {
+		g.addRune(tLink)
+	}
+	g.endLink()
 
 	g.format.clearColor()
 	g.format.clearAttributes()
@@ -220,7 +486,7 @@ func buildOutput(s *GitStatus, in chan rune, zsh bool) string {
 
 }
 
-func setColor(g *group, ch rune) {
+func setColor(g *group, o *PrintOptions, ch rune) {
 	if ch == tReset {
 		// Reset color code.
 		g.format.clearColor()
@@ -233,13 +499,33 @@ func setColor(g *group, ch rune) {
 	}
 	code, ok := colors[ch]
 	if ok {
-		g.format.setColor(code)
+		g.setColor(code, o)
 		return
 	}
 	g.addRune(tColor)
 	g.addRune(ch)
 }
 
+// setExtendedColor sets a color written as #{name}, or the underline color
+// if prefix is @. The name is a color or a palette slot of the theme.
+func setExtendedColor(g *group, o *PrintOptions, prefix rune, name string) {
+	c, ok := parseColor(name)
+	if !ok {
+		c, ok = o.Theme.color(name)
+	}
+	if !ok {
+		g.addString(string(prefix) + string(tExtOp) + name + string(tExtCl))
+		return
+	}
+	if prefix == tAttribute {
+		if c, ok := o.Colors.convert(c); ok {
+			g.format.setUnderlineColor(c)
+		}
+		return
+	}
+	g.setColor(c, o)
+}
+
 func setAttribute(g *group, ch rune) {
 	if ch == tReset {
 		// Reset attribute.
@@ -265,73 +551,185 @@ func setAttribute(g *group, ch rune) {
 	g.addRune(ch)
 }
 
-func setData(g *group, s *GitStatus, last bool, ch rune) {
+func setLink(g *group, s *GitStatus, o *PrintOptions, ch rune) {
+	switch ch {
+	case tReset:
+		g.endLink()
+	case linkRepo:
+		g.startLink(s.Remote.Web, o.Shell)
+	case linkBranch:
+		g.startLink(branchURL(s), o.Shell)
+	case linkCommit:
+		g.startLink(commitURL(s), o.Shell)
+	default:
+		g.addRune(tLink)
+		g.addRune(ch)
+	}
+}
+
+// setData adds the data token ch with the arguments of its long form. It
+// returns false for unknown tokens and invalid arguments.
+func setData(g *group, s *GitStatus, o *PrintOptions, last bool, ch rune, args []string) bool {
+	var num numberFormat
+	if countTokens[ch] {
+		var ok bool
+		if num, ok = parseNumberFormat(args); !ok {
+			return false
+		}
+	} else if len(args) > tokenArgs[ch] {
+		return false
+	}
 	switch ch {
 	case head:
+		branch, ok := branchName(s.Branch, o, args)
+		if !ok {
+			return false
+		}
 		g.hasData = true
-		g.hasValue = true
-		if s.Branch != "" {
-			g.addString(s.Branch)
-		} else {
-			g.addString(s.Sha[:7])
+		// A rewrite can hide the branch, e.g. ^wip/.*=.
+		if branch != "" {
+			g.hasValue = true
+			g.addValue(branch, o.Shell)
+		} else if s.Branch == "" && s.Sha != "" {
+			g.hasValue = true
+			g.addValue(shortSha(s.Sha), o.Shell)
 		}
 	case headcolon:
-		g.hasData = true
-		g.hasValue = true
-		if s.Branch != "" {
-			g.addString(s.Branch)
-		} else {
-			g.addString(":")
-			g.addString(s.Sha[:7])
+		branch, ok := branchName(s.Branch, o, args)
+		if !ok {
+			return false
 		}
-	case modified:
-		g.addInt(s.Modified)
 		g.hasData = true
-		if s.Modified > 0 {
+		if branch != "" {
+			g.hasValue = true
+			g.addValue(branch, o.Shell)
+		} else if s.Branch == "" && s.Sha != "" {
 			g.hasValue = true
+			g.addString(":")
+			g.addValue(shortSha(s.Sha), o.Shell)
 		}
+	case modified:
+		g.addCount(s.Modified, num)
 	case untracked:
-		g.addInt(s.Untracked)
+		g.addCount(s.Untracked, num)
+	case staged:
+		g.addCount(s.Staged, num)
+	case conflicts:
+		g.addCount(s.Conflicts, num)
+	case ahead:
+		g.addCount(s.Ahead, num)
+	case behind:
+		g.addCount(s.Behind, num)
+	case stashed:
+		g.addCount(s.Stashed, num)
+	case upstream:
 		g.hasData = true
-		if s.Untracked > 0 {
+		if s.Upstream != "" {
 			g.hasValue = true
+			g.addValue(s.Upstream, o.Shell)
+		}
+	case fetchAge:
+		precision, ok := intArg(args, 0, 1)
+		if !ok || precision < 1 {
+			return false
 		}
-	case staged:
-		g.addInt(s.Staged)
 		g.hasData = true
-		if s.Staged > 0 {
+		if s.Fetched {
 			g.hasValue = true
+			g.addString(formatAge(s.FetchAge, precision))
 		}
-	case conflicts:
-		g.addInt(s.Conflicts)
+	case repoName:
 		g.hasData = true
-		if s.Conflicts > 0 {
+		if s.Root != "" {
 			g.hasValue = true
+			g.addValue(filepath.Base(s.Root), o.Shell)
 		}
-	case ahead:
-		g.addInt(s.Ahead)
+	case repoPath:
 		g.hasData = true
-		if s.Ahead > 0 {
+		if s.Prefix != "" {
 			g.hasValue = true
+			g.addValue(shortenPath(s.Prefix, o.PathSegments, o.PathAbbrev), o.Shell)
+		}
+	case inserted:
+		g.addCount(s.Insertions, num)
+	case deleted:
+		g.addCount(s.Deletions, num)
+	case sInserted:
+		g.addCount(s.StagedInsertions, num)
+	case sDeleted:
+		g.addCount(s.StagedDeletions, num)
+	case sparsePat:
+		g.addCount(s.SparsePatterns, num)
+	case bStashed:
+		g.addCount(s.BranchStashed, num)
+	case stashAge:
+		precision, ok := intArg(args, 0, 1)
+		if !ok || precision < 1 {
+			return false
 		}
-	case behind:
-		g.addInt(s.Behind)
 		g.hasData = true
-		if s.Behind > 0 {
+		if s.Stashed > 0 {
 			g.hasValue = true
+			g.addString(formatAge(s.StashAge, precision))
 		}
-	case stashed:
-		g.addInt(s.Stashed)
+	case stashMsg:
 		g.hasData = true
-		if s.Stashed > 0 {
+		if s.StashMessage != "" {
 			g.hasValue = true
+			g.addValue(s.StashMessage, o.Shell)
+		}
+	case skipWt:
+		g.addCount(s.SkipWorktree, num)
+	case assumeUn:
+		g.addCount(s.AssumeUnchanged, num)
+	case cModified:
+		g.addCount(s.BothModified, num)
+	case cAdded:
+		g.addCount(s.BothAdded, num)
+	case cDeleted:
+		g.addCount(s.DeletedByUs+s.DeletedByThem, num)
+	case cOther:
+		g.addCount(s.BothDeleted+s.AddedByUs+s.AddedByThem, num)
+	case cBothDel:
+		g.addCount(s.BothDeleted, num)
+	case cAddedUs:
+		g.addCount(s.AddedByUs, num)
+	case cAddedThem:
+		g.addCount(s.AddedByThem, num)
+	case cDeletedUs:
+		g.addCount(s.DeletedByUs, num)
+	case cDeletedThem:
+		g.addCount(s.DeletedByThem, num)
+	case sha:
+		length, ok := intArg(args, 0, 7)
+		if !ok || length < 1 {
+			return false
 		}
-	case upstream:
 		g.hasData = true
-		if s.Upstream != "" {
+		if s.Sha != "" {
 			g.hasValue = true
-			g.addString(s.Upstream)
+			if length < len(s.Sha) {
+				g.addValue(s.Sha[:length], o.Shell)
+			} else {
+				g.addValue(s.Sha, o.Shell)
+			}
+		}
+	case unfinCnt:
+		g.addCount(s.Unfinished, num)
+	case rHost:
+		g.addText(s.Remote.Host, o.Shell)
+	case rOwner:
+		g.addText(s.Remote.Owner, o.Shell)
+	case rRepo:
+		g.addText(s.Remote.Repo, o.Shell)
+	case rWeb:
+		g.addText(s.Remote.Web, o.Shell)
+	case forge:
+		forges := o.Forges
+		if forges == nil {
+			forges = DefaultForges
 		}
+		g.addText(forgeLabel(s.Remote.Host, forges), o.Shell)
 	case clean:
 		g.hasEnabler = true
 		if s.Clean {
@@ -357,15 +755,75 @@ func setData(g *group, s *GitStatus, last bool, ch rune) {
 		if s.Upstream == "" {
 			g.wasEnabled = true
 		}
+	case unsafe:
+		g.hasEnabler = true
+		if s.Unsafe {
+			g.wasEnabled = true
+		}
+	case unborn:
+		g.hasEnabler = true
+		if s.Unborn {
+			g.wasEnabled = true
+		}
+	case gone:
+		g.hasEnabler = true
+		if s.UpstreamGone {
+			g.wasEnabled = true
+		}
+	case stale:
+		g.hasEnabler = true
+		if s.Upstream != "" && (!s.Fetched || s.FetchAge > o.StaleFetch) {
+			g.wasEnabled = true
+		}
+	case fetching:
+		g.hasEnabler = true
+		if s.Fetching {
+			g.wasEnabled = true
+		}
+	case failed:
+		g.hasEnabler = true
+		if s.FetchFailed {
+			g.wasEnabled = true
+		}
+	case largeDiff:
+		g.hasEnabler = true
+		if s.Insertions+s.Deletions+s.StagedInsertions+s.StagedDeletions > o.LargeDiff {
+			g.wasEnabled = true
+		}
+	case shallow:
+		g.hasEnabler = true
+		if s.Shallow {
+			g.wasEnabled = true
+		}
+	case partial:
+		g.hasEnabler = true
+		if s.Partial {
+			g.wasEnabled = true
+		}
+	case sparse:
+		g.hasEnabler = true
+		if s.Sparse {
+			g.wasEnabled = true
+		}
+	case hidden:
+		g.hasEnabler = true
+		if s.SkipWorktree > 0 || s.AssumeUnchanged > 0 {
+			g.wasEnabled = true
+		}
+	case unfin:
+		g.hasEnabler = true
+		if s.Unfinished > 0 {
+			g.wasEnabled = true
+		}
 	case if_else:
 		g.hasEnabler = true
 		if !last {
 			g.wasEnabled = true
 		}
 	default:
-		g.addRune(tData)
-		g.addRune(ch)
+		return false
 	}
+	return true
 }
 
 func (g *group) writeTo(b io.Writer) bool {
@@ -382,16 +840,159 @@ func (g *group) addRune(r rune) {
 	if !unicode.IsSpace(r) {
 		g.format.printANSI(&g.buf)
 	}
-	g.width++
-	g.buf.WriteRune(r)
+	g.width += runeWidth(r)
+	g.buf.WriteString(g.format.output.escape(string(r)))
 }
 
 func (g *group) addString(s string) {
 	g.format.printANSI(&g.buf)
-	g.width += len(s)
-	g.buf.WriteString(s)
+	g.width += cellWidth(s)
+	g.buf.WriteString(g.format.output.escape(s))
 }
 
-func (g *group) addInt(i int) {
-	g.addString(strconv.Itoa(i))
+// addValue adds a data value, escaped for the shell and the output.
+func (g *group) addValue(v string, sh Shell) {
+	g.format.printANSI(&g.buf)
+	g.width += cellWidth(v)
+	g.buf.WriteString(g.format.output.escape(sh.escape(v)))
+}
+
+// setColor sets the color, mapped to the colors the terminal supports.
+func (g *group) setColor(c color, o *PrintOptions) {
+	if c, ok := o.Colors.convert(c); ok {
+		g.format.setColor(c)
+	}
+}
+
+// startLink starts an OSC 8 hyperlink to target, which is zero width. The
+// link ends with the group, at the next link or with endLink. Starting a
+// link implicitly ends the previous one.
+func (g *group) startLink(target string, sh Shell) {
+	if g.format.output != OutputANSI {
+		return
+	}
+	if target == "" {
+		g.endLink()
+		return
+	}
+	// BEL terminates instead of ESC \, which bash would expand in PS1.
+	g.link = "\x1b]8;;" + sh.escape(target) + "\a"
+	g.buf.WriteString(g.link)
+}
+
+func (g *group) endLink() {
+	if g.link == "" {
+		return
+	}
+	g.buf.WriteString("\x1b]8;;\a")
+	g.link = ""
+}
+
+// addText adds a data value, which has a value if it isn't empty.
+func (g *group) addText(v string, sh Shell) {
+	g.hasData = true
+	if v != "" {
+		g.hasValue = true
+		g.addValue(v, sh)
+	}
+}
+
+// addCount adds a counter, which has a value if it isn't zero.
+func (g *group) addCount(i int, f numberFormat) {
+	g.addString(f.format(i))
+	g.hasData = true
+	if i > 0 {
+		g.hasValue = true
+	}
+}
+
+// branchName returns the branch rewritten by the options and truncated by
+// the arguments of %{head:width,end|middle}, or false if they are invalid.
+func branchName(branch string, o *PrintOptions, args []string) (string, bool) {
+	width, ok := intArg(args, 0, 0)
+	if !ok || width < 0 {
+		return "", false
+	}
+	middle := false
+	if len(args) > 1 {
+		switch args[1] {
+		case "", "end":
+		case "middle":
+			middle = true
+		default:
+			return "", false
+		}
+	}
+	branch = rewriteBranch(branch, o.BranchRewrites)
+	if width > 0 {
+		branch = truncate(branch, width, middle)
+	}
+	return branch, true
+}
+
+// shortSha returns the abbreviated sha.
+func shortSha(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
+
+// ageUnits are the units of formatAge, largest first.
+var ageUnits = []struct {
+	d    time.Duration
+	name string
+}{
+	{24 * time.Hour, "d"},
+	{time.Hour, "h"},
+	{time.Minute, "m"},
+	{time.Second, "s"},
+}
+
+// formatAge formats d in precision units starting at its largest whole unit,
+// e.g. 2d with precision 1 or 2d5h with precision 2. Units that are zero are
+// left out.
+func formatAge(d time.Duration, precision int) string {
+	i := 0
+	for i < len(ageUnits)-1 && d < ageUnits[i].d {
+		i++
+	}
+	var b strings.Builder
+	for end := i + precision; i < end && i < len(ageUnits); i++ {
+		n := d / ageUnits[i].d
+		d %= ageUnits[i].d
+		if n > 0 || b.Len() == 0 {
+			b.WriteString(strconv.Itoa(int(n)) + ageUnits[i].name)
+		}
+	}
+	return b.String()
+}
+
+// shortenPath keeps the last keep segments of the slash-separated path p and
+// abbreviates the others to their first letter, or replaces them with "…".
+func shortenPath(p string, keep int, abbrev bool) string {
+	segments := strings.Split(p, "/")
+	if keep <= 0 || len(segments) <= keep {
+		return p
+	}
+	short := segments[len(segments)-keep:]
+	if !abbrev {
+		return strings.Join(append([]string{"…"}, short...), "/")
+	}
+	head := segments[:len(segments)-keep]
+	for i, seg := range head {
+		head[i] = abbreviate(seg)
+	}
+	return strings.Join(append(head, short...), "/")
+}
+
+// abbreviate returns the first letter of s, keeping a leading dot for hidden
+// directories.
+func abbreviate(s string) string {
+	for i, r := range s {
+		if r != '.' {
+			return s[:i+len(string(r))]
+		}
+	}
+	return s
 }
@@ -5,6 +5,7 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
 var all = &GitStatus{
@@ -44,7 +45,14 @@ func TestPrint(t *testing.T) {
 			name:     "unicode",
 			format:   "%h ✋%u ⚡️%m 🚚%s ❗️%c ⬆%a ⬇%b",
 			expected: "master ✋0 ⚡️1 🚚2 ❗️3 ⬆4 ⬇5",
-			width:    26,
+			width:    28,
+		},
+		{
+			name:     "wide branch",
+			status:   &GitStatus{Branch: "功能/分支🚀"},
+			format:   "(%h)",
+			expected: "(功能/分支🚀)",
+			width:    13,
 		},
 		{
 			name:     "sha",
@@ -52,7 +60,236 @@ func TestPrint(t *testing.T) {
 			format:   "%h%H",
 			expected: "858828b:858828b",
 		},
+		{
+			name:     "fetch age",
+			status:   &GitStatus{Fetched: true, FetchAge: 90 * time.Minute},
+			format:   "[%f][ %F]",
+			expected: "1h",
+		},
+		{
+			name:     "fetch never",
+			status:   &GitStatus{},
+			format:   "[%f]",
+			expected: "",
+		},
+		{
+			name:     "fetch stale",
+			status:   &GitStatus{Upstream: "origin/master", Fetched: true, FetchAge: 2 * time.Hour},
+			format:   "%f[%F stale]",
+			expected: "2h stale",
+		},
+		{
+			name:     "fetch stale never fetched",
+			status:   &GitStatus{Upstream: "origin/master"},
+			format:   "[%F stale]",
+			expected: " stale",
+		},
+		{
+			name:     "fetch stale without upstream",
+			status:   &GitStatus{},
+			format:   "[%F stale]",
+			expected: "",
+		},
+		{
+			name:     "fetching",
+			status:   &GitStatus{Fetching: true},
+			format:   "[%P…][%X!]",
+			expected: "…",
+			width:    1,
+		},
+		{
+			name:     "fetch failed",
+			status:   &GitStatus{FetchFailed: true},
+			format:   "[%P…][%X!]",
+			expected: "!",
+		},
+		{
+			name:     "repository",
+			status:   &GitStatus{Root: "/src/repo", Prefix: "sub/dir"},
+			format:   "%r[:%p]",
+			expected: "repo:sub/dir",
+		},
+		{
+			name:     "repository root",
+			status:   &GitStatus{Root: "/src/repo"},
+			format:   "%r[:%p]",
+			expected: "repo",
+		},
+		{
+			name:     "unsafe",
+			status:   &GitStatus{Branch: "master", Unsafe: true},
+			format:   "%h[ %o!]",
+			expected: "master !",
+		},
+		{
+			name:     "unborn",
+			status:   &GitStatus{Branch: "master", Unborn: true},
+			format:   "%h[ %N(new)]",
+			expected: "master (new)",
+		},
+		{
+			name:     "no head",
+			status:   &GitStatus{},
+			format:   "<[%h][%H]>",
+			expected: "<>",
+		},
+		{
+			name:     "short sha",
+			status:   &GitStatus{Sha: "0455b"},
+			format:   "%h%H",
+			expected: "0455b:0455b",
+		},
+		{
+			name:     "diff stat",
+			status:   &GitStatus{Insertions: 1, Deletions: 2, StagedInsertions: 3},
+			format:   "[+%i][-%d][ +%j][-%k][ %zlarge]",
+			expected: "+1-2 +3",
+		},
+		{
+			name:     "large diff",
+			status:   &GitStatus{Insertions: 300, StagedDeletions: 201},
+			format:   "[%zlarge]",
+			expected: "large",
+		},
+		{
+			name:     "clone info",
+			status:   &GitStatus{Shallow: true, Sparse: true, SparsePatterns: 2},
+			format:   "[%yshallow][%Ypartial][ sparse%t][:%T]",
+			expected: "shallow sparse:2",
+		},
+		{
+			name:     "stash details",
+			status:   &GitStatus{Stashed: 3, BranchStashed: 1, StashAge: 49 * time.Hour, StashMessage: "wip"},
+			format:   "%S[/%B][ %A][ %M]",
+			expected: "3/1 2d wip",
+		},
+		{
+			name:     "no stash",
+			status:   &GitStatus{},
+			format:   "[%S][/%B][ %A][ %M]",
+			expected: "",
+		},
+		{
+			name:     "hidden",
+			status:   &GitStatus{SkipWorktree: 2},
+			format:   "[%W!][ S%w][ A%q]",
+			expected: "! S2",
+		},
+		{
+			name:     "conflict kinds",
+			status:   &GitStatus{Conflicts: 6, BothModified: 3, DeletedByUs: 1, DeletedByThem: 1, AddedByThem: 1},
+			format:   "%c[ ✗%x][ +%n][ ⊘%v][ ?%R]",
+			expected: "6 ✗3 ⊘2 ?1",
+			width:    10,
+		},
+		{
+			name:     "unfinished",
+			status:   &GitStatus{Ahead: 3, Unfinished: 2},
+			format:   "↑%a[ %K!][ wip:%Q][ %W?]",
+			expected: "↑3 ! wip:2",
+			width:    10,
+		},
+		{
+			name: "remote",
+			status: &GitStatus{Remote: Remote{
+				Host: "gitlab.com", Owner: "group/sub", Repo: "repo", Web: "https://gitlab.com/group/sub/repo",
+			}},
+			format:   "[%G ][%J/]%V %E %Z",
+			expected: "GitLab group/sub/repo gitlab.com https://gitlab.com/group/sub/repo",
+		},
+		{
+			name:     "local remote",
+			status:   &GitStatus{Remote: Remote{Repo: "repo"}},
+			format:   "[%G ][%J/]%V[ %Z]",
+			expected: "repo",
+		},
+		// long tokens
+		{
+			name:     "long tokens",
+			format:   "%{head}[ %{ahead}][ %{if-clean}clean][ %{if-dirty}dirty]",
+			expected: "master 4 clean",
+		},
+		{
+			name:     "sha length",
+			status:   &GitStatus{Sha: "858828b5e153f24644bc867598298b50f8223f9b"},
+			format:   "%{sha} %{sha:12} %{sha:99}",
+			expected: "858828b 858828b5e153 858828b5e153f24644bc867598298b50f8223f9b",
+		},
+		{
+			name:     "fetch age precision",
+			status:   &GitStatus{Fetched: true, FetchAge: 26*time.Hour + 5*time.Second},
+			format:   "%{fetch-age}|%{fetch-age:2}|%{fetch-age:4}",
+			expected: "1d|1d2h|1d2h5s",
+		},
+		{
+			name:     "conflict kinds long",
+			status:   &GitStatus{Conflicts: 3, BothDeleted: 1, AddedByThem: 2},
+			format:   "%{both-deleted}[ %{added-by-us}][ %{added-by-them}]",
+			expected: "1 2",
+		},
+		{
+			name:     "branch width",
+			status:   &GitStatus{Branch: "feature/JIRA-12345-long-description"},
+			format:   "%{head:12} %{head:12,middle} %{head-colon:99,end}",
+			expected: "feature/JIR… featur…ption feature/JIRA-12345-long-description",
+			width:    61,
+		},
+		{
+			name:     "branch width sha",
+			status:   &GitStatus{Sha: "858828b5e153f24644bc867598298b50f8223f9b"},
+			format:   "%{head:3}%{head-colon:3,middle}",
+			expected: "858828b:858828b",
+		},
+		{
+			name:     "invalid branch width",
+			format:   "%{head:-1}%{head:5,start}",
+			expected: "%{head:-1}%{head:5,start}",
+		},
+		{
+			name:     "number formats",
+			status:   &GitStatus{Untracked: 1532, Modified: 120, Ahead: 3, Behind: 0},
+			format:   "%{untracked:si} %{modified:99}[ %{ahead:sup}][ %{behind:sub}] %{untracked:999,si,sub}",
+			expected: "1.5k 99+ ³ ₉₉₉₊",
+			width:    15,
+		},
+		{
+			name:     "invalid number formats",
+			format:   "%{staged:0}%{ahead:k}",
+			expected: "%{staged:0}%{ahead:k}",
+		},
+		{
+			name:     "invalid long tokens",
+			format:   "%{nope}%{staged:x}%{sha:x}%{fetch-age:0}%{",
+			expected: "%{nope}%{staged:x}%{sha:x}%{fetch-age:0}%{",
+			width:    42,
+		},
+		// links
+		{
+			name:     "link branch",
+			status:   &GitStatus{Branch: "dev", Upstream: "origin/main", Remote: Remote{Name: "origin", Host: "github.com", Web: "https://github.com/o/r"}},
+			format:   "[&b%h] x",
+			expected: "\x1b]8;;https://github.com/o/r/tree/main\adev\x1b]8;;\a x",
+			width:    5,
+		},
+		{
+			name:     "link scoped to group",
+			status:   &GitStatus{Sha: "858828b5e153f24644bc867598298b50f8223f9b", Remote: Remote{Host: "gitlab.com", Web: "https://gitlab.com/o/r"}},
+			format:   "&r[&c%h][ &_-]!&_.",
+			expected: "\x1b]8;;https://gitlab.com/o/r\a\x1b]8;;https://gitlab.com/o/r/-/commit/858828b5e153f24644bc867598298b50f8223f9b\a858828b\x1b]8;;https://gitlab.com/o/r\a \x1b]8;;\a-\x1b]8;;https://gitlab.com/o/r\a!\x1b]8;;\a.",
+			width:    11,
+		},
+		{
+			name:     "link without remote",
+			format:   "[&b%h]&r&x&",
+			expected: "master&x&",
+		},
 		// colors
+		{
+			name:     "extended colors",
+			format:   "#{196}a#{#00ff00}b[#{x}c]#{",
+			expected: "\x1b[38;5;196ma\x1b[38;2;0;255;0mb\x1b[0m#{x}c#{",
+			width:    9,
+		},
 		{
 			name:     "red",
 			format:   "#r%h",
@@ -98,9 +335,39 @@ func TestPrint(t *testing.T) {
 		{
 			name:     "reset attribute",
 			format:   "#ggreen @b@igreen_bold_italic @Bgreen_italic",
-			expected: "\x1b[32mgreen \x1b[1;3mgreen_bold_italic \x1b[0;3;32mgreen_italic\x1b[0m",
+			expected: "\x1b[32mgreen \x1b[1;3mgreen_bold_italic \x1b[22mgreen_italic\x1b[0m",
 			width:    36,
 		},
+		{
+			name:     "reset color keeps attributes",
+			format:   "@b#rA#_B",
+			expected: "\x1b[1;31mA\x1b[39mB\x1b[0m",
+			width:    2,
+		},
+		{
+			name:     "shared reset code",
+			format:   "@b@fA@FB",
+			expected: "\x1b[1;2mA\x1b[22;1mB\x1b[0m",
+			width:    2,
+		},
+		{
+			name:     "extended attributes",
+			format:   "@u@r@s@o@kA@R@S@O@KB",
+			expected: "\x1b[4;5;7;9;53mA\x1b[25;27;29;55mB\x1b[0m",
+			width:    2,
+		},
+		{
+			name:     "underline styles",
+			format:   "@cA@dB@{196}C@uD@UE",
+			expected: "\x1b[4:3mA\x1b[24;21mB\x1b[58;5;196mC\x1b[24;4mD\x1b[0mE",
+			width:    5,
+		},
+		{
+			name:     "underline color",
+			format:   "#r@u@{#ff0000}A[@{r}B@{g}]C",
+			expected: "\x1b[4;58;2;255;0;0;31mA\x1b[0m@{r}B@{g}C",
+			width:    11,
+		},
 		{
 			name:     "ending with #",
 			format:   "%h#",
@@ -122,6 +389,12 @@ func TestPrint(t *testing.T) {
 			format:   "<[%h][ B%b A%a][ U%u][ C%c][ %CX][%ll][%eY]>",
 			expected: "<master B5 A4 C3 XY>",
 		},
+		{
+			name:     "group upstream gone",
+			status:   &GitStatus{Branch: "feature", Upstream: "origin/feature", UpstreamGone: true},
+			format:   "%h[ %U][%g gone]",
+			expected: "feature origin/feature gone",
+		},
 		{
 			name:     "group color auto-reset",
 			format:   "<[#r%h]-[#g%u]%a[-#b%b]>",
@@ -164,13 +437,13 @@ func TestPrint(t *testing.T) {
 		},
 		{
 			name:     "data invalid odd",
-			format:   "%%%z",
-			expected: "%%%z",
+			format:   "%%%~",
+			expected: "%%%~",
 		},
 		{
 			name:     "data invalid even",
-			format:   "%%%%z",
-			expected: "%%%%z",
+			format:   "%%%%~",
+			expected: "%%%%~",
 		},
 		{
 			name:     "color valid odd",
@@ -293,6 +566,335 @@ func TestPrint(t *testing.T) {
 	}
 }
 
+func TestPrintShell(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   *GitStatus
+		shell    Shell
+		format   string
+		expected string
+	}{
+		{
+			name:     "zsh percent",
+			status:   &GitStatus{Branch: "feat/100%done"},
+			shell:    ShellZsh,
+			format:   "#r%h",
+			expected: "%{\x1b[31mfeat/100%%done\x1b[0m%13G%}",
+		},
+		{
+			name:     "zsh prompt sequence",
+			status:   &GitStatus{Branch: "%F{red}x%f", Upstream: "origin/%F{red}x%f"},
+			shell:    ShellZsh,
+			format:   "%h %U",
+			expected: "%{%%F{red}x%%f origin/%%F{red}x%%f%28G%}",
+		},
+		{
+			name:     "zsh literal format text",
+			status:   &GitStatus{Branch: "%n"},
+			shell:    ShellZsh,
+			format:   "%%%h",
+			expected: "%{%%%%n%4G%}",
+		},
+		{
+			name:     "zsh link",
+			status:   &GitStatus{Branch: "feat/100%", Remote: Remote{Host: "github.com", Web: "https://github.com/o/r"}},
+			shell:    ShellZsh,
+			format:   "&b%h",
+			expected: "%{\x1b]8;;https://github.com/o/r/tree/feat/100%%25\afeat/100%%\x1b]8;;\a%9G%}",
+		},
+		{
+			name:     "bash link",
+			status:   &GitStatus{Branch: "$x", Remote: Remote{Host: "github.com", Web: "https://github.com/o/r"}},
+			shell:    ShellBash,
+			format:   "&b%h",
+			expected: "\x1b]8;;https://github.com/o/r/tree/\\$x\a\\$x\x1b]8;;\a",
+		},
+		{
+			name:     "bash expansions",
+			status:   &GitStatus{Branch: "$(reboot)`id`", Upstream: "origin/a\\b"},
+			shell:    ShellBash,
+			format:   "%h %U",
+			expected: "\\$(reboot)\\`id\\` origin/a\\\\b",
+		},
+		{
+			name:     "bash history expansion",
+			status:   &GitStatus{Branch: "fix!", Upstream: "origin/!!"},
+			shell:    ShellBash,
+			format:   "%h %U",
+			expected: "fix\\041 origin/\\041\\041",
+		},
+		{
+			name:     "bash literal format text",
+			status:   &GitStatus{Branch: "master"},
+			shell:    ShellBash,
+			format:   "$ %h",
+			expected: "$ master",
+		},
+		{
+			name:     "fish",
+			status:   &GitStatus{Branch: "100%$(x)\\"},
+			shell:    ShellFish,
+			format:   "%h",
+			expected: "100%$(x)\\",
+		},
+		{
+			name:     "control characters",
+			status:   &GitStatus{Branch: "a\x1b[31mb\x07", Root: "/src/r\n"},
+			shell:    ShellNone,
+			format:   "%h %r",
+			expected: "a?[31mb? r?",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual := PrintWith(test.status, test.format, PrintOptions{Shell: test.shell})
+			if actual != test.expected {
+				fail(t, "Output mismatch", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestPrintOutput(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   *GitStatus
+		output   Output
+		shell    Shell
+		format   string
+		expected string
+	}{
+		{
+			name:     "tmux",
+			output:   OutputTmux,
+			format:   "#r@b%h[#G +%m]@f !",
+			expected: "#[bold,fg=red]master #[nobold,fg=brightgreen]+1 #[dim,fg=default]!#[default]",
+		},
+		{
+			name:     "tmux clear attribute",
+			output:   OutputTmux,
+			format:   "@b@i#ca@Bb#_c",
+			expected: "#[bold,italics,fg=cyan]a#[nobold]b#[fg=default]c#[default]",
+		},
+		{
+			name:     "tmux extended attributes",
+			output:   OutputTmux,
+			format:   "@s%h@S@u@{196}!",
+			expected: "#[strikethrough]master#[nostrikethrough,underscore,us=colour196]!#[default]",
+		},
+		{
+			name:     "tmux escape",
+			status:   &GitStatus{Branch: "#[x]", Remote: Remote{Web: "https://example.com"}},
+			output:   OutputTmux,
+			format:   "\\#%h &b#[x",
+			expected: "####[x] ##[x",
+		},
+		{
+			name:     "tmux zsh",
+			status:   &GitStatus{Branch: "100%"},
+			output:   OutputTmux,
+			shell:    ShellZsh,
+			format:   "#r%h",
+			expected: "#[fg=red]100%%#[default]",
+		},
+		{
+			name:     "plain",
+			output:   OutputPlain,
+			format:   "#r@b%h[#G +%m] &r",
+			expected: "master +1 ",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.status == nil {
+				test.status = &GitStatus{Branch: "master", Modified: 1, Remote: Remote{Web: "https://example.com"}}
+			}
+			actual := PrintWith(test.status, test.format, PrintOptions{Output: test.output, Shell: test.shell})
+			if actual != test.expected {
+				fail(t, "Output mismatch", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestPrintColors(t *testing.T) {
+	format := "#{#ff8000}a#{38}b#rc@bd"
+	tests := map[ColorSupport]string{
+		ColorTrue: "\x1b[38;2;255;128;0ma\x1b[38;5;38mb\x1b[31mc\x1b[1md\x1b[0m",
+		Color256:  "\x1b[38;5;208ma\x1b[38;5;38mb\x1b[31mc\x1b[1md\x1b[0m",
+		Color16:   "\x1b[33ma\x1b[36mb\x1b[31mc\x1b[1md\x1b[0m",
+		ColorNone: "abc\x1b[1md\x1b[0m",
+	}
+	for support, expected := range tests {
+		actual := PrintWith(&GitStatus{}, format, PrintOptions{Colors: support})
+		if actual != expected {
+			fail(t, "Output mismatch", expected, actual)
+		}
+	}
+}
+
+func TestPrintNoReset(t *testing.T) {
+	tests := []struct {
+		output   Output
+		format   string
+		expected string
+	}{
+		{OutputANSI, "#r@bA#_B@_C", "\x1b[1;31mA\x1b[39mB\x1b[22mC"},
+		{OutputANSI, "[#r@u@{1}A]B", "\x1b[4;58;5;1;31mA\x1b[24;59;39mB"},
+		{OutputANSI, "@i#{#000000}A", "\x1b[3;38;2;0;0;0mA\x1b[23;39m"},
+		{OutputTmux, "[#r@bA]B", "#[bold,fg=red]A#[nobold,fg=default]B"},
+	}
+	for _, test := range tests {
+		actual := PrintWith(&GitStatus{}, test.format, PrintOptions{Output: test.output, NoReset: true})
+		if actual != test.expected {
+			fail(t, "Output mismatch", test.expected, actual)
+		}
+	}
+}
+
+func TestPrintTitle(t *testing.T) {
+	s := &GitStatus{Branch: "100%", Modified: 1, Remote: Remote{Host: "github.com", Web: "https://github.com/o/r"}}
+	format := "#r@b[&b%h]#_[ #y+%m] &x"
+
+	assertString(t, "none", "\x1b]2;100% +1 &x\a", PrintTitle(s, format, PrintOptions{}))
+	assertString(t, "zsh", "%{\x1b]2;100%% +1 &x\a%}", PrintTitle(s, format, PrintOptions{Shell: ShellZsh}))
+}
+
+func TestFormatDetails(t *testing.T) {
+	tests := map[string]Details{
+		"":                  0,
+		"%h %m":             0,
+		"%h[ +%i]":          DiffStat,
+		"[%z!]":             DiffStat,
+		"[%K!%Q]":           Unfinished,
+		"%G %J/%V":          RemoteInfo,
+		"[&b%h]&_":          RemoteInfo,
+		"&_":                0,
+		"\\&b":              0,
+		"#{%i}":             0,
+		"@{%i}%{if-hidden}": Hidden,
+		"#{inserted}":       0,
+		"%{inserted}":       DiffStat,
+		"%{if-hidden}":      Hidden,
+		"%{nope:%i}":        0,
+		"%i%W":              DiffStat | Hidden,
+		"\\%i":              0,
+		"%%i":               0,
+		"%%%i":              DiffStat,
+		"#%i":               0,
+		"@%i":               0,
+		"trailing %":        0,
+	}
+	for format, expected := range tests {
+		if actual := FormatDetails(format); actual != expected {
+			t.Errorf("%q: expected %v, got %v", format, expected, actual)
+		}
+	}
+}
+
+func TestPrintEmptyStatus(t *testing.T) {
+	// Every token must be safe to print for a zero status.
+	var format strings.Builder
+	for r := rune(0x21); r < 0x7f; r++ {
+		format.WriteRune('%')
+		format.WriteRune(r)
+		format.WriteRune(' ')
+	}
+	PrintWith(&GitStatus{}, format.String(), PrintOptions{})
+}
+
+func TestPrintStaleFetch(t *testing.T) {
+	s := &GitStatus{Upstream: "origin/master", Fetched: true, FetchAge: 10 * time.Minute}
+	o := PrintOptions{StaleFetch: 5 * time.Minute}
+	assertString(t, "output", "stale", PrintWith(s, "[%Fstale]", o))
+	o.StaleFetch = 15 * time.Minute
+	assertString(t, "output", "", PrintWith(s, "[%Fstale]", o))
+}
+
+func TestPrintBranchRewrites(t *testing.T) {
+	s := &GitStatus{Branch: "feature/JIRA-12345-long-description"}
+	prefix, err := ParseBranchPrefix("feature/=f/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rewrite, err := ParseBranchRewrite("-[a-z-]+$=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := PrintOptions{BranchRewrites: []BranchRewrite{prefix}}
+	assertString(t, "prefix", "f/JIRA-12345-long-description", PrintWith(s, "%h", o))
+	o.BranchRewrites = append(o.BranchRewrites, rewrite)
+	assertString(t, "rewrite", "f/JIRA-12345", PrintWith(s, "%h", o))
+	assertString(t, "truncated", "f/JIRA…", PrintWith(s, "%{head:7}", o))
+
+	// Rewriting the branch to nothing hides it, not the sha.
+	hide, err := ParseBranchRewrite("^wip/.*=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.BranchRewrites = []BranchRewrite{hide}
+	s = &GitStatus{Branch: "wip/experiment", Sha: "0455b83f923a40f0b485665c44aa068bc25029f5"}
+	assertString(t, "hidden", "", PrintWith(s, "[%h]", o))
+	assertString(t, "hidden colon", "", PrintWith(s, "[%H]", o))
+	assertString(t, "hidden group", "x", PrintWith(s, "[%h]x", o))
+}
+
+func TestFormatAge(t *testing.T) {
+	tests := map[time.Duration]string{
+		0:                    "0s",
+		59 * time.Second:     "59s",
+		time.Minute:          "1m",
+		119 * time.Minute:    "1h",
+		49 * time.Hour:       "2d",
+		400 * 24 * time.Hour: "400d",
+	}
+	for d, expected := range tests {
+		assertString(t, d.String(), expected, formatAge(d, 1))
+	}
+}
+
+func TestFormatAgePrecision(t *testing.T) {
+	d := 49*time.Hour + 30*time.Second
+	assertString(t, "1", "2d", formatAge(d, 1))
+	assertString(t, "2", "2d1h", formatAge(d, 2))
+	assertString(t, "3", "2d1h", formatAge(d, 3))
+	assertString(t, "4", "2d1h30s", formatAge(d, 4))
+	assertString(t, "seconds", "5s", formatAge(5*time.Second, 3))
+}
+
+func TestLongTokenAliases(t *testing.T) {
+	for name, ch := range longTokens {
+		if ch >= 0x80 {
+			continue
+		}
+		short := PrintWith(all, "[%"+string(ch)+"]", PrintOptions{})
+		long := PrintWith(all, "[%{"+name+"}]", PrintOptions{})
+		if short != long {
+			t.Errorf("%s: expected %q like %%%c, got %q", name, short, ch, long)
+		}
+	}
+}
+
+func TestShortenPath(t *testing.T) {
+	tests := []struct {
+		path     string
+		keep     int
+		abbrev   bool
+		expected string
+	}{
+		{"a/b/c", 0, false, "a/b/c"},
+		{"a/b/c", 3, false, "a/b/c"},
+		{"a/b/c", 5, true, "a/b/c"},
+		{"src/pkg/deep/dir", 2, false, "…/deep/dir"},
+		{"src/pkg/deep/dir", 1, true, "s/p/d/dir"},
+		{".config/über/x", 1, true, ".c/ü/x"},
+	}
+	for _, test := range tests {
+		actual := shortenPath(test.path, test.keep, test.abbrev)
+		assertString(t, fmt.Sprintf("%s %d %v", test.path, test.keep, test.abbrev), test.expected, actual)
+	}
+}
+
 func fail(t *testing.T, message, expected, actual string) {
 	t.Helper()
 	t.Errorf(
@@ -0,0 +1,209 @@
+package gitprompt
+
+import (
+	"net/url"
+	"path"
+	"strings"
+)
+
+// DefaultForges are the labels printed by %G for well-known hosts. Hosts are
+// matched including their subdomains.
+var DefaultForges = map[string]string{
+	"github.com":    "GitHub",
+	"gitlab.com":    "GitLab",
+	"bitbucket.org": "Bitbucket",
+	"codeberg.org":  "Codeberg",
+	"sr.ht":         "SourceHut",
+	"dev.azure.com": "Azure DevOps",
+}
+
+// forgePaths are the paths of branch and commit pages relative to the web
+// page of a repository, by host.
+var forgePaths = map[string]struct{ branch, commit string }{
+	"github.com":    {"/tree/", "/commit/"},
+	"gitlab.com":    {"/-/tree/", "/-/commit/"},
+	"bitbucket.org": {"/src/", "/commits/"},
+	"codeberg.org":  {"/src/branch/", "/commit/"},
+	"sr.ht":         {"/tree/", "/commit/"},
+}
+
+// Remote is a remote repository URL split into its parts.
+type Remote struct {
+	// Name is the name of the remote, e.g. origin.
+	Name string
+	// Host is the lowercase host name without user or port, empty for
+	// local repositories.
+	Host string
+	// Owner is the path to the repository without its name, e.g. the user
+	// or organization and any subgroups.
+	Owner string
+	// Repo is the name of the repository without the .git suffix.
+	Repo string
+	// Web is the https URL of the repository's web page, assuming the
+	// forge uses the same path as git. Empty for local repositories.
+	Web string
+}
+
+// parseRemote parses the remote of the current branch, or origin if the
+// branch doesn't track a remote branch.
+func parseRemote(config []string, s *GitStatus) {
+	name := "origin"
+	if s.Branch != "" {
+		remote, err := runGit(config, "config", "--get", "branch."+s.Branch+".remote")
+		// "." tracks a local branch.
+		if err == nil && remote != "" && remote != "." {
+			name = remote
+		}
+	}
+	// get-url applies url.<base>.insteadOf rewrites.
+	rawURL, err := runGit(config, "remote", "get-url", name)
+	if err != nil {
+		return
+	}
+	s.Remote = parseRemoteURL(rawURL)
+	s.Remote.Name = name
+}
+
+// parseRemoteURL parses the URL of a remote in any of the forms git accepts:
+// URLs like https://host/owner/repo.git or ssh://git@host:22/owner/repo, the
+// scp-like git@host:owner/repo.git and local paths.
+func parseRemoteURL(rawURL string) Remote {
+	var r Remote
+	var repoPath, scheme string
+	if i := strings.Index(rawURL, "://"); i > 0 {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return r
+		}
+		scheme = strings.ToLower(u.Scheme)
+		if scheme != "file" {
+			r.Host = strings.ToLower(u.Hostname())
+		}
+		repoPath = u.Path
+		if scheme == "http" || scheme == "https" {
+			// Only web URLs share the port with the web page.
+			if port := u.Port(); port != "" {
+				r.Web = scheme + "://" + r.Host + ":" + port
+			} else {
+				r.Web = scheme + "://" + r.Host
+			}
+		}
+	} else if host, p, ok := splitSCP(rawURL); ok {
+		r.Host = strings.ToLower(host)
+		repoPath = p
+	} else {
+		repoPath = strings.ReplaceAll(rawURL, `\`, "/")
+	}
+
+	repoPath = strings.TrimSuffix(strings.Trim(repoPath, "/"), ".git")
+	r.Owner, r.Repo = path.Split(repoPath)
+	r.Owner = strings.TrimSuffix(r.Owner, "/")
+	if r.Host == "" {
+		// The directories above a local repository aren't an owner.
+		r.Owner = ""
+		r.Web = ""
+		return r
+	}
+	if r.Web == "" {
+		r.Web = "https://" + r.Host
+	}
+	if repoPath != "" {
+		r.Web += "/" + repoPath
+	}
+	return r
+}
+
+// splitSCP splits a scp-like address [user@]host:path. Like git, it's only
+// scp-like if the colon comes before any slash, and single letter hosts are
+// Windows drive letters.
+func splitSCP(rawURL string) (host, p string, ok bool) {
+	start := 0
+	if strings.HasPrefix(rawURL, "[") {
+		// [user@host:port]:path
+		start = strings.Index(rawURL, "]")
+		if start < 0 {
+			return "", "", false
+		}
+	}
+	colon := strings.Index(rawURL[start:], ":")
+	if colon < 0 {
+		return "", "", false
+	}
+	colon += start
+	if slash := strings.IndexAny(rawURL, `/\`); slash >= 0 && slash < colon {
+		return "", "", false
+	}
+	host = strings.Trim(rawURL[:colon], "[]")
+	if at := strings.LastIndex(host, "@"); at >= 0 {
+		host = host[at+1:]
+	}
+	if i := strings.Index(host, ":"); i >= 0 {
+		host = host[:i]
+	}
+	if len(host) <= 1 {
+		return "", "", false
+	}
+	return host, rawURL[colon+1:], true
+}
+
+// forgeLabel returns the label for host in forges, matching subdomains too.
+func forgeLabel(host string, forges map[string]string) string {
+	for _, h := range hostSuffixes(host) {
+		if label, ok := forges[h]; ok {
+			return label
+		}
+	}
+	return ""
+}
+
+// hostSuffixes returns host and its parent domains, e.g. git.sr.ht, sr.ht
+// and ht.
+func hostSuffixes(host string) []string {
+	var suffixes []string
+	for host != "" {
+		suffixes = append(suffixes, host)
+		i := strings.Index(host, ".")
+		if i < 0 {
+			break
+		}
+		host = host[i+1:]
+	}
+	return suffixes
+}
+
+// branchURL returns the web URL of the current branch on the remote. It
+// falls back to the repository's web page if the branch is detached or the
+// forge is unknown.
+func branchURL(s *GitStatus) string {
+	branch := s.Branch
+	if s.Remote.Name != "" && strings.HasPrefix(s.Upstream, s.Remote.Name+"/") {
+		// The branch may have a different name on the remote.
+		branch = strings.TrimPrefix(s.Upstream, s.Remote.Name+"/")
+	}
+	for _, h := range hostSuffixes(s.Remote.Host) {
+		if paths, ok := forgePaths[h]; ok && branch != "" {
+			return s.Remote.Web + paths.branch + escapePath(branch)
+		}
+	}
+	return s.Remote.Web
+}
+
+// commitURL returns the web URL of the current commit on the remote, or the
+// repository's web page like branchURL.
+func commitURL(s *GitStatus) string {
+	for _, h := range hostSuffixes(s.Remote.Host) {
+		if paths, ok := forgePaths[h]; ok && s.Sha != "" {
+			return s.Remote.Web + paths.commit + s.Sha
+		}
+	}
+	return s.Remote.Web
+}
+
+// escapePath escapes the segments of a slash separated path for a URL.
+func escapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
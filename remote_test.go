@@ -0,0 +1,138 @@
+package gitprompt
+
+import (
+	"testing"
+)
+
+func TestParseRemoteURL(t *testing.T) {
+	tests := map[string]Remote{
+		"https://github.com/akupila/gitprompt.git": {
+			Host: "github.com", Owner: "akupila", Repo: "gitprompt", Web: "https://github.com/akupila/gitprompt",
+		},
+		"https://user@GitHub.com/akupila/gitprompt/": {
+			Host: "github.com", Owner: "akupila", Repo: "gitprompt", Web: "https://github.com/akupila/gitprompt",
+		},
+		"http://git.example.com:8080/team/repo": {
+			Host: "git.example.com", Owner: "team", Repo: "repo", Web: "http://git.example.com:8080/team/repo",
+		},
+		"ssh://git@gitlab.com:2222/group/sub/repo.git": {
+			Host: "gitlab.com", Owner: "group/sub", Repo: "repo", Web: "https://gitlab.com/group/sub/repo",
+		},
+		"git://example.org/repo.git": {
+			Host: "example.org", Repo: "repo", Web: "https://example.org/repo",
+		},
+		"git@github.com:akupila/gitprompt.git": {
+			Host: "github.com", Owner: "akupila", Repo: "gitprompt", Web: "https://github.com/akupila/gitprompt",
+		},
+		"github.com:akupila/gitprompt": {
+			Host: "github.com", Owner: "akupila", Repo: "gitprompt", Web: "https://github.com/akupila/gitprompt",
+		},
+		"[git@example.org:22]:owner/repo.git": {
+			Host: "example.org", Owner: "owner", Repo: "repo", Web: "https://example.org/owner/repo",
+		},
+		"/srv/git/repo.git":        {Repo: "repo"},
+		"../repo":                  {Repo: "repo"},
+		"./a:b/repo.git":           {Repo: "repo"},
+		"file:///srv/git/repo.git": {Repo: "repo"},
+		`C:\repos\repo.git`:        {Repo: "repo"},
+		"":                         {},
+	}
+	for rawURL, expected := range tests {
+		if actual := parseRemoteURL(rawURL); actual != expected {
+			t.Errorf("%q: expected %+v, got %+v", rawURL, expected, actual)
+		}
+	}
+}
+
+func TestForgeLabel(t *testing.T) {
+	forges := map[string]string{"github.com": "GH", "corp.example": "Corp", "git.corp.example": ""}
+	tests := map[string]string{
+		"github.com":           "GH",
+		"ssh.github.com":       "GH",
+		"notgithub.com":        "",
+		"gitlab.corp.example":  "Corp",
+		"git.corp.example":     "",
+		"sub.git.corp.example": "",
+		"example":              "",
+		"":                     "",
+	}
+	for host, expected := range tests {
+		if actual := forgeLabel(host, forges); actual != expected {
+			t.Errorf("%q: expected %q, got %q", host, expected, actual)
+		}
+	}
+}
+
+func TestParseRemote(t *testing.T) {
+	dir, done := setupTestDir(t)
+	defer done()
+
+	setupCommands(t, dir, `
+		git init --initial-branch=master || git init
+		git commit --allow-empty -m 'initial'
+		git remote add origin git@github.com:owner/origin.git
+		git remote add fork https://gitlab.com/me/fork.git
+	`)
+
+	s, _ := Parse()
+	if s.Remote != (Remote{}) {
+		t.Errorf("Remote parsed without detail: %+v", s.Remote)
+	}
+
+	s, _ = ParseWith(ParseOptions{Details: RemoteInfo})
+	assertString(t, "Repo", "origin", s.Remote.Repo)
+
+	setupCommands(t, dir, `
+		git config branch.master.remote fork
+		git config branch.master.merge refs/heads/master
+	`)
+	s, _ = ParseWith(ParseOptions{Details: RemoteInfo})
+	assertString(t, "Host", "gitlab.com", s.Remote.Host)
+	assertString(t, "Repo", "fork", s.Remote.Repo)
+
+	setupCommands(t, dir, `
+		git config branch.master.remote .
+		git remote remove origin
+	`)
+	s, _ = ParseWith(ParseOptions{Details: RemoteInfo})
+	if s.Remote != (Remote{}) {
+		t.Errorf("Remote parsed without origin: %+v", s.Remote)
+	}
+}
+
+func TestLinkURLs(t *testing.T) {
+	github := Remote{Name: "origin", Host: "github.com", Web: "https://github.com/o/r"}
+	tests := []struct {
+		status *GitStatus
+		branch string
+		commit string
+	}{
+		{
+			status: &GitStatus{Branch: "feat/a b", Sha: "abc", Remote: github},
+			branch: "https://github.com/o/r/tree/feat/a%20b",
+			commit: "https://github.com/o/r/commit/abc",
+		},
+		{
+			status: &GitStatus{Branch: "local", Upstream: "origin/feat/remote", Remote: github},
+			branch: "https://github.com/o/r/tree/feat/remote",
+			commit: "https://github.com/o/r",
+		},
+		{
+			status: &GitStatus{Branch: "b", Sha: "abc", Remote: Remote{Host: "git.sr.ht", Web: "https://git.sr.ht/~o/r"}},
+			branch: "https://git.sr.ht/~o/r/tree/b",
+			commit: "https://git.sr.ht/~o/r/commit/abc",
+		},
+		{
+			status: &GitStatus{Branch: "b", Sha: "abc", Remote: Remote{Host: "git.example.com", Web: "https://git.example.com/o/r"}},
+			branch: "https://git.example.com/o/r",
+			commit: "https://git.example.com/o/r",
+		},
+		{
+			status: &GitStatus{Branch: "b", Sha: "abc"},
+		},
+	}
+	for _, test := range tests {
+		assertString(t, "branchURL", test.branch, branchURL(test.status))
+		assertString(t, "commitURL", test.commit, commitURL(test.status))
+	}
+}
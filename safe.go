@@ -0,0 +1,102 @@
+package gitprompt
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// unsafeConfig matches the names of config variables that make git run
+// programs. In safe mode they're cleared if the repository sets them.
+const unsafeConfig = `^(` +
+	`core\.(fsmonitor|sshcommand|askpass|gitproxy|pager|editor|alternaterefscommand)|` +
+	`diff\.external|sequence\.editor|credential\..*helper|gpg\.(.*\.)?program|` +
+	`filter\..*\.(clean|smudge|process)|diff\..*\.(command|textconv)|merge\..*\.driver|` +
+	`remote\..*\.(uploadpack|receivepack|vcs)` +
+	`)$`
+
+// safeConfig returns git -c arguments that keep git from running programs
+// configured in the repository's config files: hooks and the ext:: transport
+// are disabled and every variable matching unsafeConfig is cleared. Variables
+// set outside of the repository, e.g. in ~/.gitconfig, are only overridden if
+// the repository sets them too. The files are read with the git arguments in
+// args, which must find the same repository as the later git commands so
+// that includeIf sections are included the same way.
+func safeConfig(args []string, configFiles ...string) []string {
+	config := []string{"-c", "core.hooksPath=" + os.DevNull, "-c", "protocol.ext.allow=never"}
+	seen := map[string]bool{}
+	for _, file := range configFiles {
+		if _, err := os.Stat(file); err != nil {
+			continue
+		}
+		names, err := runGit(args, "config", "--file", file, "--includes", "--name-only", "--get-regexp", unsafeConfig)
+		if err != nil {
+			// Exits with 1 if nothing matches.
+			continue
+		}
+		for _, name := range strings.Split(names, "\n") {
+			if name == "" || seen[name] {
+				continue
+			}
+			seen[name] = true
+			value := ""
+			if name == "core.fsmonitor" {
+				value = "false"
+			}
+			config = append(config, "-c", name+"="+value)
+		}
+	}
+	return config
+}
+
+// gitConfigFile returns the path to the config file of the repository in
+// gitDir.
+func gitConfigFile(gitDir string) (string, error) {
+	file, err := runGitCommand("git", "--git-dir", gitDir, "rev-parse", "--git-path", "config")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(file)
+}
+
+// safeTransports are the URL schemes of git's built-in transports. Other
+// schemes and <transport>::<address> URLs are handled by remote helpers,
+// e.g. ext:: runs any command.
+var safeTransports = map[string]bool{
+	"http": true, "https": true, "ssh": true, "git+ssh": true, "ssh+git": true,
+	"git": true, "file": true,
+}
+
+// safeRemoteURL reports whether git fetches from url with a built-in
+// transport. scp-like URLs and local paths are safe.
+func safeRemoteURL(url string) bool {
+	if strings.Contains(url, "::") {
+		return false
+	}
+	if i := strings.Index(url, "://"); i >= 0 {
+		return safeTransports[strings.ToLower(url[:i])]
+	}
+	return true
+}
+
+// checkRemotes returns ErrUnsafeRemote if a remote's URL needs a remote
+// helper. URLs are checked after url.<base>.insteadOf rewrites, which can't
+// be cleared with -c.
+func checkRemotes(config []string) error {
+	remotes, err := runGit(config, "remote")
+	if err != nil {
+		return err
+	}
+	for _, remote := range strings.Fields(remotes) {
+		urls, err := runGit(config, "remote", "get-url", "--all", remote)
+		if err != nil {
+			return err
+		}
+		for _, url := range strings.Split(urls, "\n") {
+			if !safeRemoteURL(url) {
+				return ErrUnsafeRemote
+			}
+		}
+	}
+	return nil
+}
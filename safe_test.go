@@ -0,0 +1,158 @@
+package gitprompt
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestParseSafeMode(t *testing.T) {
+	dir, done := setupTestDir(t)
+	defer done()
+
+	marker := path.Join(dir, ".git", "pwned")
+	setupCommands(t, dir, `
+		git init --initial-branch=master || git init
+		git commit --allow-empty -m 'initial'
+		printf '#!/bin/sh\ntouch `+marker+`\nexit 1\n' > .git/fsmonitor
+		chmod +x .git/fsmonitor
+		git config core.fsmonitor .git/fsmonitor
+	`)
+
+	s, err := Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, "Branch", "master", s.Branch)
+	if _, err := os.Stat(marker); err == nil {
+		t.Errorf("Expected fsmonitor not to run in safe mode")
+	}
+
+	if _, err := ParseWith(ParseOptions{Trusted: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(marker); err != nil {
+		t.Errorf("Expected fsmonitor to run when trusted: %v", err)
+	}
+}
+
+func TestParseSafeModeSubmodule(t *testing.T) {
+	dir, done := setupTestDir(t)
+	defer done()
+
+	marker := path.Join(dir, ".git", "pwned")
+	setupCommands(t, dir, `
+		git init --initial-branch=master || git init
+		git init src
+		git -C src commit --allow-empty -m 'initial'
+		git -c protocol.file.allow=always submodule add ./src sub
+		git commit -m 'submodule'
+		printf '#!/bin/sh\ntouch `+marker+`\nexit 1\n' > .git/fsmonitor
+		chmod +x .git/fsmonitor
+		git config -f .git/modules/sub/config core.fsmonitor `+path.Join(dir, ".git", "fsmonitor")+`
+	`)
+
+	if _, err := ParseWith(ParseOptions{Details: DiffStat}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Errorf("Expected fsmonitor of a submodule not to run in safe mode")
+	}
+}
+
+func TestParseUnsafe(t *testing.T) {
+	dir, done := setupTestDir(t)
+	defer done()
+
+	setupCommands(t, dir, `
+		git init --initial-branch=master || git init
+		git commit --allow-empty -m 'initial'
+		touch test
+	`)
+
+	os.Setenv("GIT_TEST_ASSUME_DIFFERENT_OWNER", "1")
+	defer os.Unsetenv("GIT_TEST_ASSUME_DIFFERENT_OWNER")
+
+	if _, err := Parse(); err != ErrUnsafeRepository {
+		t.Errorf("Expected ErrUnsafeRepository, got %v", err)
+	}
+	if _, err := ParseWith(ParseOptions{Trusted: true, AllowUnsafe: true}); err != ErrUnsafeRepository {
+		t.Errorf("Expected ErrUnsafeRepository when trusted, got %v", err)
+	}
+
+	s, err := ParseWith(ParseOptions{AllowUnsafe: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertBool(t, "Unsafe", true, s.Unsafe)
+	assertString(t, "Branch", "master", s.Branch)
+	assertInt(t, "Untracked", 1, s.Untracked)
+	assertBool(t, "FetchDue", false, FetchDue(s, 0))
+}
+
+func TestParseUnsafeIncludeIf(t *testing.T) {
+	dir, done := setupTestDir(t)
+	defer done()
+
+	marker := path.Join(dir, ".git", "pwned")
+	setupCommands(t, dir, `
+		git init --initial-branch=master || git init
+		git commit --allow-empty -m 'initial'
+		printf '#!/bin/sh\ntouch `+marker+`\nexit 1\n' > .git/fsmonitor
+		chmod +x .git/fsmonitor
+		git config -f .git/fsmonitor.inc core.fsmonitor .git/fsmonitor
+		git config includeIf.onbranch:master.path fsmonitor.inc
+	`)
+
+	os.Setenv("GIT_TEST_ASSUME_DIFFERENT_OWNER", "1")
+	defer os.Unsetenv("GIT_TEST_ASSUME_DIFFERENT_OWNER")
+
+	if _, err := ParseWith(ParseOptions{AllowUnsafe: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Errorf("Expected fsmonitor from an included file not to run")
+	}
+}
+
+func TestSafeConfig(t *testing.T) {
+	dir, done := setupTestDir(t)
+	defer done()
+
+	setupCommands(t, dir, `
+		git init --initial-branch=master || git init
+		git config core.fsmonitor /bin/evil
+		git config filter.Evil.clean /bin/evil
+		git config diff.evil.textconv /bin/evil
+		git config --add credential.helper /bin/evil
+		git config --add credential.helper /bin/evil
+		git config user.name safe
+	`)
+
+	config := strings.Join(safeConfig(nil, path.Join(dir, ".git", "config"), path.Join(dir, "missing")), " ")
+	assertString(t, "config", "-c core.hooksPath="+os.DevNull+
+		" -c protocol.ext.allow=never"+
+		" -c core.fsmonitor=false"+
+		" -c filter.Evil.clean="+
+		" -c diff.evil.textconv="+
+		" -c credential.helper=", config)
+}
+
+func TestSafeRemoteURL(t *testing.T) {
+	tests := map[string]bool{
+		"https://github.com/akupila/gitprompt.git": true,
+		"SSH://git@github.com/akupila/gitprompt":   true,
+		"git@github.com:akupila/gitprompt.git":     true,
+		"file:///srv/git/repo.git":                 true,
+		"/srv/git/repo.git":                        true,
+		"../repo":                                  true,
+		"ext::sh -c touch% /tmp/pwned":             false,
+		"fd::17":                                   false,
+		"https::example.com/repo":                  false,
+		"custom://example.com/repo":                false,
+	}
+	for url, expected := range tests {
+		assertBool(t, url, expected, safeRemoteURL(url))
+	}
+}
@@ -0,0 +1,79 @@
+package gitprompt
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Shell is the shell whose prompt the output is embedded in. It determines
+// how data values such as branch names are escaped, so they're printed as-is
+// rather than interpreted by the shell.
+type Shell int
+
+// Supported shells.
+const (
+	// ShellNone doesn't escape values.
+	ShellNone Shell = iota
+	// ShellZsh escapes prompt sequences (%) and adds width control
+	// characters.
+	ShellZsh
+	// ShellBash escapes backslashes and expansions ($, `) for output that
+	// becomes part of PS1, e.g. when it is set from PROMPT_COMMAND.
+	ShellBash
+	// ShellFish prints values as-is, fish doesn't interpret the output of
+	// fish_prompt.
+	ShellFish
+)
+
+var shellNames = map[string]Shell{
+	"none": ShellNone,
+	"zsh":  ShellZsh,
+	"bash": ShellBash,
+	"fish": ShellFish,
+}
+
+// ShellByName returns the shell with the name, one of none, zsh, bash or
+// fish.
+func ShellByName(name string) (Shell, bool) {
+	sh, ok := shellNames[name]
+	return sh, ok
+}
+
+func (sh Shell) String() string {
+	for name, s := range shellNames {
+		if s == sh {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+// escape escapes the value for the shell. Control characters are replaced
+// for all shells, they could otherwise be used to inject escape sequences.
+func (sh Shell) escape(v string) string {
+	var b strings.Builder
+	for _, r := range v {
+		if unicode.IsControl(r) {
+			b.WriteRune('?')
+			continue
+		}
+		switch sh {
+		case ShellZsh:
+			if r == '%' {
+				b.WriteRune('%')
+			}
+		case ShellBash:
+			if r == '!' {
+				// ! is the history number in PS1 in POSIX mode, while !!
+				// is only decoded to ! there. \041 is ! in both modes.
+				b.WriteString("\\041")
+				continue
+			}
+			if r == '\\' || r == '$' || r == '`' {
+				b.WriteRune('\\')
+			}
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
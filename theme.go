@@ -0,0 +1,130 @@
+package gitprompt
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Theme maps the names of palette slots, used as #{name} in formats, to
+// colors: a color token such as R, a 256 color palette index or #rrggbb. An
+// empty color is the default color.
+type Theme map[string]string
+
+// DefaultTheme is used if PrintOptions.Theme is not set. Every theme has its
+// slots.
+var DefaultTheme = Theme{
+	"frame":     "B",
+	"branch":    "R",
+	"upstream":  "c",
+	"staged":    "y",
+	"modified":  "g",
+	"untracked": "y",
+	"conflicts": "r",
+	"ahead":     "m",
+	"behind":    "m",
+	"stashed":   "c",
+	"clean":     "g",
+	"dirty":     "r",
+	"warning":   "Y",
+	"muted":     "K",
+}
+
+// Themes are the built-in themes by name.
+var Themes = map[string]Theme{
+	"default": DefaultTheme,
+	"mono": {
+		"frame": "", "branch": "", "upstream": "", "staged": "", "modified": "",
+		"untracked": "", "conflicts": "", "ahead": "", "behind": "", "stashed": "",
+		"clean": "", "dirty": "", "warning": "", "muted": "",
+	},
+	"solarized": {
+		"frame": "#586e75", "branch": "#268bd2", "upstream": "#2aa198",
+		"staged": "#859900", "modified": "#b58900", "untracked": "#cb4b16",
+		"conflicts": "#dc322f", "ahead": "#6c71c4", "behind": "#d33682",
+		"stashed": "#2aa198", "clean": "#859900", "dirty": "#dc322f",
+		"warning": "#b58900", "muted": "#586e75",
+	},
+	"nord": {
+		"frame": "#4c566a", "branch": "#88c0d0", "upstream": "#8fbcbb",
+		"staged": "#a3be8c", "modified": "#ebcb8b", "untracked": "#d08770",
+		"conflicts": "#bf616a", "ahead": "#b48ead", "behind": "#b48ead",
+		"stashed": "#81a1c1", "clean": "#a3be8c", "dirty": "#bf616a",
+		"warning": "#ebcb8b", "muted": "#4c566a",
+	},
+	"gruvbox": {
+		"frame": "#928374", "branch": "#fabd2f", "upstream": "#83a598",
+		"staged": "#b8bb26", "modified": "#8ec07c", "untracked": "#fe8019",
+		"conflicts": "#fb4934", "ahead": "#d3869b", "behind": "#d3869b",
+		"stashed": "#83a598", "clean": "#b8bb26", "dirty": "#fb4934",
+		"warning": "#fabd2f", "muted": "#928374",
+	},
+}
+
+// ParseTheme parses a theme with one name=color slot per line, e.g.
+// "branch=#268bd2". Empty lines and lines starting with # are ignored.
+// Slots that aren't set are taken from DefaultTheme.
+func ParseTheme(r io.Reader) (Theme, error) {
+	theme := Theme{}
+	for name, c := range DefaultTheme {
+		theme[name] = c
+	}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := theme.Set(line); err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return theme, nil
+}
+
+// Set sets a slot from a name=color definition.
+func (t Theme) Set(def string) error {
+	parts := strings.SplitN(def, "=", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("expected name=color, got %q", def)
+	}
+	name, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+	if name == "" {
+		return fmt.Errorf("expected name=color, got %q", def)
+	}
+	if _, ok := parseThemeColor(value); !ok {
+		return fmt.Errorf("invalid color %q for %s", value, name)
+	}
+	t[name] = value
+	return nil
+}
+
+// color returns the color of the slot, or false if the theme doesn't have
+// it.
+func (t Theme) color(name string) (color, bool) {
+	if t == nil {
+		t = DefaultTheme
+	}
+	value, ok := t[name]
+	if !ok {
+		return 0, false
+	}
+	return parseThemeColor(value)
+}
+
+// parseThemeColor parses a color in a theme.
+func parseThemeColor(value string) (color, bool) {
+	if value == "" {
+		return 0, true
+	}
+	if r := []rune(value); len(r) == 1 {
+		if c, ok := colors[r[0]]; ok {
+			return c, true
+		}
+	}
+	return parseColor(value)
+}
@@ -0,0 +1,61 @@
+package gitprompt
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestThemes(t *testing.T) {
+	for name, theme := range Themes {
+		for slot := range DefaultTheme {
+			if _, ok := theme.color(slot); !ok {
+				t.Errorf("%s: missing or invalid slot %s", name, slot)
+			}
+		}
+	}
+}
+
+func TestParseTheme(t *testing.T) {
+	theme, err := ParseTheme(strings.NewReader(`
+# branches are blue
+branch = #268bd2
+dirty=R
+muted=244
+custom=
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, "branch", "#268bd2", theme["branch"])
+	assertString(t, "dirty", "R", theme["dirty"])
+	assertString(t, "muted", "244", theme["muted"])
+	assertString(t, "staged", DefaultTheme["staged"], theme["staged"])
+	if c, ok := theme["custom"]; !ok || c != "" {
+		t.Errorf("custom: expected empty color, got %q", c)
+	}
+
+	for _, invalid := range []string{"branch", "=R", "branch=red", "branch=#fff"} {
+		if _, err := ParseTheme(strings.NewReader(invalid)); err == nil {
+			t.Errorf("%q: expected error", invalid)
+		}
+	}
+}
+
+func TestPrintTheme(t *testing.T) {
+	theme := Theme{"branch": "#ff0000", "dirty": "1", "none": ""}
+	tests := []struct {
+		theme    Theme
+		format   string
+		expected string
+	}{
+		{theme, "#{branch}a#{dirty}b#{none}c", "\x1b[38;2;255;0;0ma\x1b[38;5;1mb\x1b[0mc"},
+		{theme, "#{staged}a@u@{dirty}b", "#{staged}a\x1b[4;58;5;1mb\x1b[0m"},
+		{nil, "#{branch}a#{frame}b", "\x1b[91ma\x1b[94mb\x1b[0m"},
+	}
+	for _, test := range tests {
+		actual := PrintWith(&GitStatus{}, test.format, PrintOptions{Theme: test.theme})
+		if actual != test.expected {
+			fail(t, "Output mismatch", test.expected, actual)
+		}
+	}
+}
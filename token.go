@@ -0,0 +1,128 @@
+package gitprompt
+
+import (
+	"strconv"
+	"strings"
+)
+
+// longTokens are the names of data tokens in their long form, %{name} or
+// %{name:arg1,arg2}.
+var longTokens = map[string]rune{
+	"head":              head,
+	"head-colon":        headcolon,
+	"untracked":         untracked,
+	"modified":          modified,
+	"staged":            staged,
+	"conflicts":         conflicts,
+	"ahead":             ahead,
+	"behind":            behind,
+	"stashed":           stashed,
+	"upstream":          upstream,
+	"fetch-age":         fetchAge,
+	"repo":              repoName,
+	"path":              repoPath,
+	"inserted":          inserted,
+	"deleted":           deleted,
+	"staged-inserted":   sInserted,
+	"staged-deleted":    sDeleted,
+	"sparse-patterns":   sparsePat,
+	"branch-stashed":    bStashed,
+	"stash-age":         stashAge,
+	"stash-message":     stashMsg,
+	"skip-worktree":     skipWt,
+	"assume-unchanged":  assumeUn,
+	"both-modified":     cModified,
+	"both-added":        cAdded,
+	"deleted-conflicts": cDeleted,
+	"other-conflicts":   cOther,
+	"unfinished":        unfinCnt,
+	"remote-host":       rHost,
+	"remote-owner":      rOwner,
+	"remote-repo":       rRepo,
+	"remote-url":        rWeb,
+	"forge":             forge,
+	"if-clean":          clean,
+	"if-dirty":          dirty,
+	"if-outdated":       outdated,
+	"if-latest":         latest,
+	"if-local":          local,
+	"if-unborn":         unborn,
+	"if-unsafe":         unsafe,
+	"if-gone":           gone,
+	"if-stale":          stale,
+	"if-fetching":       fetching,
+	"if-fetch-failed":   failed,
+	"if-large-diff":     largeDiff,
+	"if-shallow":        shallow,
+	"if-partial":        partial,
+	"if-sparse":         sparse,
+	"if-hidden":         hidden,
+	"if-unfinished":     unfin,
+	"else":              if_else,
+	"sha":               sha,
+	"both-deleted":      cBothDel,
+	"added-by-us":       cAddedUs,
+	"added-by-them":     cAddedThem,
+	"deleted-by-us":     cDeletedUs,
+	"deleted-by-them":   cDeletedThem,
+}
+
+// Tokens that only have a long form. They are surrogate halves, which are
+// never decoded from a format, so they can't be used as short tokens.
+const (
+	sha          rune = 0xd800 + iota // %{sha:length}
+	cBothDel                          // %{both-deleted}
+	cAddedUs                          // %{added-by-us}
+	cAddedThem                        // %{added-by-them}
+	cDeletedUs                        // %{deleted-by-us}
+	cDeletedThem                      // %{deleted-by-them}
+)
+
+// tokenArgs are the maximum number of arguments of data tokens.
+var tokenArgs = map[rune]int{
+	head:      2,
+	headcolon: 2,
+	fetchAge:  1,
+	stashAge:  1,
+	sha:       1,
+}
+
+// countTokens are the tokens that print counts. They take any number of
+// number format arguments, e.g. %{untracked:99,si}.
+var countTokens = map[rune]bool{
+	modified: true, untracked: true, staged: true, conflicts: true,
+	ahead: true, behind: true, stashed: true, inserted: true, deleted: true,
+	sInserted: true, sDeleted: true, sparsePat: true, bStashed: true,
+	skipWt: true, assumeUn: true, cModified: true, cAdded: true,
+	cDeleted: true, cOther: true, cBothDel: true, cAddedUs: true,
+	cAddedThem: true, cDeletedUs: true, cDeletedThem: true, unfinCnt: true,
+}
+
+// parseLongToken splits a long token, without %{ and }, into the token and
+// its arguments.
+func parseLongToken(token string) (rune, []string, bool) {
+	name, args := token, []string(nil)
+	if i := strings.Index(token, ":"); i >= 0 {
+		name, args = token[:i], strings.Split(token[i+1:], ",")
+	}
+	ch, ok := longTokens[name]
+	return ch, args, ok
+}
+
+// setLongData adds a data token in its long form.
+func setLongData(g *group, s *GitStatus, o *PrintOptions, last bool, token string) bool {
+	ch, args, ok := parseLongToken(token)
+	if !ok {
+		return false
+	}
+	return setData(g, s, o, last, ch, args)
+}
+
+// intArg returns the i-th argument as an integer, or def if it's not set.
+func intArg(args []string, i, def int) (int, bool) {
+	if i >= len(args) || args[i] == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(args[i])
+	return n, err == nil
+}
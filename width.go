@@ -0,0 +1,77 @@
+package gitprompt
+
+import (
+	"unicode"
+)
+
+// wideRanges are the ranges of runes that take two cells in a terminal: East
+// Asian wide and fullwidth characters and emoji.
+var wideRanges = [][2]rune{
+	{0x1100, 0x115f},   // Hangul Jamo
+	{0x231a, 0x231b},   // watch, hourglass
+	{0x23e9, 0x23ec},   // media controls
+	{0x23f0, 0x23f3},   // alarm clock, timers
+	{0x25fd, 0x25fe},   // small squares
+	{0x2614, 0x2615},   // umbrella, hot beverage
+	{0x2648, 0x2653},   // zodiac
+	{0x26a1, 0x26a1},   // high voltage
+	{0x26aa, 0x26ab},   // circles
+	{0x26bd, 0x26be},   // balls
+	{0x26c4, 0x26c5},   // snowman, sun behind cloud
+	{0x26d4, 0x26d4},   // no entry
+	{0x26ea, 0x26ea},   // church
+	{0x26f2, 0x26f5},   // fountain, golf, sailboat
+	{0x26fa, 0x26fd},   // tent, fuel pump
+	{0x2705, 0x2705},   // check mark
+	{0x270a, 0x270b},   // raised fist, hand
+	{0x2728, 0x2728},   // sparkles
+	{0x274c, 0x274e},   // cross marks
+	{0x2753, 0x2757},   // question and exclamation marks
+	{0x2795, 0x2797},   // plus, minus, division
+	{0x27b0, 0x27bf},   // loops
+	{0x2b1b, 0x2b1c},   // large squares
+	{0x2b50, 0x2b55},   // star, circle
+	{0x2e80, 0x303e},   // CJK radicals, punctuation
+	{0x3041, 0x33ff},   // kana, CJK symbols
+	{0x3400, 0x4dbf},   // CJK extension A
+	{0x4e00, 0x9fff},   // CJK unified ideographs
+	{0xa000, 0xa4cf},   // Yi
+	{0xac00, 0xd7a3},   // Hangul syllables
+	{0xf900, 0xfaff},   // CJK compatibility ideographs
+	{0xfe30, 0xfe4f},   // CJK compatibility forms
+	{0xff00, 0xff60},   // fullwidth forms
+	{0xffe0, 0xffe6},   // fullwidth signs
+	{0x1f300, 0x1f64f}, // pictographs, emoticons
+	{0x1f680, 0x1f6ff}, // transport and map symbols
+	{0x1f900, 0x1f9ff}, // supplemental pictographs
+	{0x1fa70, 0x1faff}, // symbols and pictographs extended-A
+	{0x20000, 0x2fffd}, // CJK extensions
+	{0x30000, 0x3fffd}, // CJK extension G
+}
+
+// runeWidth returns the number of terminal cells r takes: zero for combining
+// marks, variation selectors and other format characters, two for wide
+// characters and one otherwise.
+func runeWidth(r rune) int {
+	if r == 0 || unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf) {
+		return 0
+	}
+	for _, wide := range wideRanges {
+		if r < wide[0] {
+			break
+		}
+		if r <= wide[1] {
+			return 2
+		}
+	}
+	return 1
+}
+
+// cellWidth returns the number of terminal cells s takes.
+func cellWidth(s string) int {
+	width := 0
+	for _, r := range s {
+		width += runeWidth(r)
+	}
+	return width
+}
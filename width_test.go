@@ -0,0 +1,26 @@
+package gitprompt
+
+import (
+	"testing"
+)
+
+func TestCellWidth(t *testing.T) {
+	tests := map[string]int{
+		"":           0,
+		"master":     6,
+		"über":       4,
+		"u\u0308ber": 4,
+		"功能":         4,
+		"ｆｕｌｌ":       8,
+		"🚚 ⚡️ ❗️":    8,
+		"↓↑›":        3,
+		"a\u200db":   2,
+		"\x1b":       1,
+		"한국어 branch": 13,
+	}
+	for s, expected := range tests {
+		if actual := cellWidth(s); actual != expected {
+			t.Errorf("%q: expected %d, got %d", s, expected, actual)
+		}
+	}
+}